@@ -0,0 +1,32 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// adminRoutes returns the handler of the admin listener, which serves the
+// internal metrics, profiles and health probes. It must not be reachable from
+// the internet, it has no authentication.
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthcheck", app.healthcheckHandler)
+	mux.HandleFunc("GET /livez", app.livezHandler)
+	mux.HandleFunc("GET /readyz", app.readyzHandler(true))
+
+	// Metric routes
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.Handle("GET /metrics", app.promMetrics.handler())
+
+	// Profiling routes, pprof.Index serves the named profiles too
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+
+	return app.recoverPanic(mux)
+}
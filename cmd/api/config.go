@@ -0,0 +1,521 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"greenlight.chetraseng.com/internal/ratelimit"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+// envPrefix prefixes the environment variable of every setting, such as
+// GREENLIGHT_DB_DSN for -db-dsn
+const envPrefix = "GREENLIGHT_"
+
+// secretFlags are redacted when the config is printed
+var secretFlags = []string{"db-dsn", "smtp-username", "smtp-password", "jwt-secret", "s3-access-key", "s3-secret-key"}
+
+// repeatableFlags take a list of values, one per occurrence on the command
+// line. Other lists in the config file are joined with spaces.
+var repeatableFlags = []string{"limiter-route"}
+
+// flagAliases maps the deprecated flag names to the setting they are another
+// name for. Both names are one setting in every layer, the deprecated one
+// losing to the other when a layer sets both.
+var flagAliases = map[string]string{"Environment": "env"}
+
+// loadOptions are the command line options which are not settings
+type loadOptions struct {
+	configFile     string
+	printConfig    bool
+	displayVersion bool
+
+	// flags holds the settings as loaded, for printConfig
+	flags *flag.FlagSet
+}
+
+// loadConfig builds the config in layers: the flag defaults, then the YAML
+// config file, then GREENLIGHT_* environment variables and finally the flags
+// given in args. Keys of the config file are the flag names, or nested maps
+// whose keys joined with "-" are, so "db: {dsn: ...}" sets -db-dsn.
+func loadConfig(args []string) (config, loadOptions, error) {
+	var (
+		cfg  config
+		opts loadOptions
+	)
+
+	fs := flag.NewFlagSet("greenlight", flag.ContinueOnError)
+	registerFlags(fs, &cfg)
+	opts.flags = fs
+
+	fs.StringVar(&opts.configFile, "config", os.Getenv(envPrefix+"CONFIG"), "YAML config file")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "Print the effective config, with secrets redacted, and exit")
+	fs.BoolVar(&opts.displayVersion, "version", false, "Display version and exit")
+
+	err := fs.Parse(args)
+
+	if err != nil {
+		return config{}, opts, err
+	}
+
+	// Flags given on the command line win over every other layer
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for alias, name := range flagAliases {
+		if explicit[alias] || explicit[name] {
+			explicit[alias], explicit[name] = true, true
+		}
+	}
+
+	if opts.configFile != "" {
+		values, err := readConfigFile(opts.configFile)
+
+		if err != nil {
+			return config{}, opts, err
+		}
+
+		for alias, name := range flagAliases {
+			if _, ok := values[name]; ok {
+				delete(values, alias)
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(values)) {
+			err = setFlag(fs, explicit, name, values[name], fmt.Sprintf("%s: %s", opts.configFile, name))
+
+			if err != nil {
+				return config{}, opts, err
+			}
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+
+		if name, ok := flagAliases[f.Name]; ok {
+			if _, set := os.LookupEnv(envName(name)); set {
+				return
+			}
+		}
+
+		name := envName(f.Name)
+
+		if value, ok := os.LookupEnv(name); ok && !isOption(f.Name) {
+			err = setFlag(fs, explicit, f.Name, []string{value}, name)
+		}
+	})
+
+	if err != nil {
+		return config{}, opts, err
+	}
+
+	if opts.printConfig || opts.displayVersion {
+		return cfg, opts, nil
+	}
+
+	return cfg, opts, cfg.validate()
+}
+
+// envName returns the environment variable of the setting name
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setFlag sets the flag name from a config layer, unless it was given on the
+// command line
+func setFlag(fs *flag.FlagSet, explicit map[string]bool, name string, values []string, source string) error {
+	f := fs.Lookup(name)
+
+	if f == nil || isOption(name) {
+		return fmt.Errorf("%s: unknown setting", source)
+	}
+
+	if explicit[name] {
+		return nil
+	}
+
+	if !slices.Contains(repeatableFlags, name) {
+		values = []string{strings.Join(values, " ")}
+	}
+
+	for _, value := range values {
+		err := f.Value.Set(value)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+	}
+
+	return nil
+}
+
+// isOption reports whether name is one of the loadOptions rather than a
+// setting
+func isOption(name string) bool {
+	return name == "config" || name == "print-config" || name == "version"
+}
+
+// readConfigFile reads the YAML config file into the values of its settings,
+// keyed by flag name
+func readConfigFile(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var doc map[string]any
+
+	err = yaml.NewDecoder(f).Decode(&doc)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := map[string][]string{}
+
+	err = flattenConfig(values, "", doc)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func flattenConfig(values map[string][]string, prefix string, node map[string]any) error {
+	for key, value := range node {
+		name := key
+
+		if prefix != "" {
+			name = prefix + "-" + key
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			err := flattenConfig(values, name, v)
+
+			if err != nil {
+				return err
+			}
+		case []any:
+			list := make([]string, 0, len(v))
+
+			for _, item := range v {
+				if _, ok := item.(map[string]any); ok {
+					return fmt.Errorf("%s: lists may only hold plain values", name)
+				}
+
+				list = append(list, fmt.Sprint(item))
+			}
+
+			values[name] = list
+		case nil:
+			values[name] = []string{""}
+		default:
+			values[name] = []string{fmt.Sprint(v)}
+		}
+	}
+
+	return nil
+}
+
+// registerFlags defines every setting of cfg along with its default
+func registerFlags(fs *flag.FlagSet, cfg *config) {
+	fs.IntVar(&cfg.port, "port", 4000, "API Server port")
+	fs.StringVar(&cfg.admin.addr, "admin-addr", "localhost:4001", "Admin listener address for metrics, pprof and probes (empty to disable)")
+	fs.DurationVar(&cfg.server.idleTimeout, "server-idle-timeout", time.Minute, "How long keep-alive connections are kept open between requests")
+	fs.DurationVar(&cfg.server.readTimeout, "server-read-timeout", 5*time.Second, "Maximum duration for reading a request, body included")
+	fs.DurationVar(&cfg.server.writeTimeout, "server-write-timeout", 10*time.Second, "Maximum duration for writing a response")
+
+	// Read TLS config
+	fs.StringVar(&cfg.tls.certFile, "tls-cert-file", "", "TLS certificate chain in PEM, serves the API over HTTPS along with -tls-key-file")
+	fs.StringVar(&cfg.tls.keyFile, "tls-key-file", "", "TLS private key in PEM")
+	fs.StringVar(&cfg.tls.minVersion, "tls-min-version", "1.2", "Minimum TLS version (1.2|1.3)")
+	fs.BoolVar(&cfg.tls.http2, "http2", true, "Serve HTTP/2 to the clients negotiating it over TLS")
+	fs.StringVar(&cfg.tls.redirectAddr, "tls-redirect-addr", "", "Listener address redirecting plain HTTP requests to HTTPS, such as :80 (empty to disable)")
+	fs.DurationVar(&cfg.tls.hstsMaxAge, "hsts-max-age", 0, "Max age of the Strict-Transport-Security header sent over HTTPS (0 to disable)")
+
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	fs.StringVar(&cfg.env, "Environment", "development", "Deprecated: use -env")
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+
+	// Read db config settings
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+
+	// Read limiter
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum request per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.Float64Var(&cfg.limiter.userRPS, "limiter-user-rps", 10, "Rate limiter maximum request per second for authenticated users")
+	fs.IntVar(&cfg.limiter.userBurst, "limiter-user-burst", 20, "Rate limiter maximum burst for authenticated users")
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	fs.StringVar(&cfg.limiter.store, "limiter-store", "memory", "Rate limiter store (memory|postgres), postgres shares the limits between instances")
+	fs.BoolVar(&cfg.limiter.failOpen, "limiter-fail-open", true, "Allow requests when the rate limiter store fails, rather than rejecting them")
+
+	// Expensive routes get limits of their own, which can be overridden
+	cfg.limiter.routes = map[string]ratelimit.Limit{
+		"POST /v1/tokens/authentication": {Rate: 0.2, Burst: 5},
+		"POST /v1/movies/import":         {Rate: 1.0 / 60, Burst: 2},
+	}
+
+	fs.Var(routeLimitsValue(cfg.limiter.routes), "limiter-route", `Rate limit of a route as "METHOD /pattern=rps,burst", such as "PATCH /v1/movies/:id=1,5" (repeatable)`)
+
+	// Read SMTP config
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.chetraseng.com>", "SMTP sender")
+
+	fs.StringVar(&cfg.logLevel, "log-level", "info", "Minimum level of the messages logged (debug|info|warn|error)")
+
+	// Read JWT secret
+	fs.StringVar(&cfg.jwt.secret, "jwt-secret", "", "JWT secret")
+
+	// Read cors trusted origins
+	fs.Var((*fieldsValue)(&cfg.cors.trustedOrigins), "cors-trusted-origins", "Trusted CORS origins (space separated)")
+
+	fs.BoolVar(&cfg.legacyErrors, "legacy-errors", false, "Send errors in the legacy {\"error\": ...} format rather than as application/problem+json")
+
+	fs.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long idempotency keys and their responses are kept")
+
+	// Read image storage config
+	fs.StringVar(&cfg.storage.backend, "storage-backend", "local", "Image storage backend (local|s3)")
+	fs.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Local image storage directory")
+	fs.StringVar(&cfg.storage.publicURL, "storage-public-url", "", "Base URL images are served from (defaults to /media on this server for local storage)")
+	fs.StringVar(&cfg.storage.s3.endpoint, "s3-endpoint", "", "S3 compatible endpoint, such as http://localhost:9000")
+	fs.StringVar(&cfg.storage.s3.region, "s3-region", "us-east-1", "S3 region")
+	fs.StringVar(&cfg.storage.s3.bucket, "s3-bucket", "", "S3 bucket")
+	fs.StringVar(&cfg.storage.s3.accessKey, "s3-access-key", "", "S3 access key")
+	fs.StringVar(&cfg.storage.s3.secretKey, "s3-secret-key", "", "S3 secret key")
+	fs.BoolVar(&cfg.storage.s3.pathStyle, "s3-path-style", true, "Use path-style S3 addressing")
+
+	// Read health probe config
+	fs.BoolVar(&cfg.health.smtp, "readyz-smtp", false, "Check that the SMTP server can be dialled in readiness probes")
+	fs.DurationVar(&cfg.health.drainDelay, "drain-delay", 0, "How long to keep serving after reporting not ready on shutdown, so load balancers can drain the API")
+
+	// Read tracing config
+	fs.StringVar(&cfg.tracing.exporter, "tracing-exporter", "none", "Trace exporter (none|stdout|file|otlp)")
+	fs.StringVar(&cfg.tracing.endpoint, "tracing-otlp-endpoint", "http://localhost:4318", "OTLP/HTTP collector URL")
+	fs.StringVar(&cfg.tracing.file, "tracing-file", "traces.json", "File the file exporter appends spans to")
+	fs.Float64Var(&cfg.tracing.sampleRatio, "tracing-sample-ratio", 1, "Ratio of traces started by the API which are sampled")
+}
+
+// validate checks the settings which can not be right whatever else is set.
+// Every problem is reported at once.
+func (cfg config) validate() error {
+	v := validator.New()
+
+	envs := []string{"development", "staging", "production"}
+
+	v.Check(validator.PermittedValue(cfg.env, envs...), "env", validator.OneOf(envs...))
+	_, err := parseLogLevel(cfg.logLevel)
+
+	v.Check(err == nil, "log-level", validator.OneOf("debug", "info", "warn", "error"))
+	v.Check(cfg.port >= 1 && cfg.port <= 65535, "port", validator.Range(1, 65535))
+	v.Check(cfg.server.idleTimeout >= 0, "server-idle-timeout", validator.Invalid("min", "must not be negative"))
+	v.Check(cfg.server.readTimeout >= 0, "server-read-timeout", validator.Invalid("min", "must not be negative"))
+	v.Check(cfg.server.writeTimeout >= 0, "server-write-timeout", validator.Invalid("min", "must not be negative"))
+
+	// The certificate and its key only make sense together
+	v.Check(cfg.tls.keyFile != "" || cfg.tls.certFile == "", "tls-key-file", validator.Invalid("required", "must be provided with tls-cert-file"))
+	v.Check(cfg.tls.certFile != "" || cfg.tls.keyFile == "", "tls-cert-file", validator.Invalid("required", "must be provided with tls-key-file"))
+	_, err = parseTLSVersion(cfg.tls.minVersion)
+
+	v.Check(err == nil, "tls-min-version", validator.OneOf("1.2", "1.3"))
+	v.Check(cfg.tls.redirectAddr == "" || cfg.tlsEnabled(), "tls-redirect-addr", validator.Invalid("tls", "requires tls-cert-file and tls-key-file"))
+	v.Check(cfg.tls.hstsMaxAge >= 0, "hsts-max-age", validator.Invalid("min", "must not be negative"))
+	v.Check(cfg.db.dsn != "", "db-dsn", validator.Required())
+	v.Check(cfg.db.maxOpenConns >= 0, "db-max-open-conns", validator.Min(0))
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", validator.Min(0))
+
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.rps > 0, "limiter-rps", validator.Invalid("min", "must be greater than zero"))
+		v.Check(cfg.limiter.burst >= 1, "limiter-burst", validator.Min(1))
+		v.Check(cfg.limiter.userRPS > 0, "limiter-user-rps", validator.Invalid("min", "must be greater than zero"))
+		v.Check(cfg.limiter.userBurst >= 1, "limiter-user-burst", validator.Min(1))
+	}
+
+	v.Check(validator.PermittedValue(cfg.limiter.store, "memory", "postgres"), "limiter-store", validator.OneOf("memory", "postgres"))
+	v.Check(validator.PermittedValue(cfg.storage.backend, "local", "s3"), "storage-backend", validator.OneOf("local", "s3"))
+
+	if cfg.storage.backend == "s3" {
+		v.Check(cfg.storage.s3.bucket != "", "s3-bucket", validator.Required())
+	}
+
+	exporters := []string{"none", "stdout", "file", "otlp"}
+
+	v.Check(validator.PermittedValue(cfg.tracing.exporter, exporters...), "tracing-exporter", validator.OneOf(exporters...))
+	v.Check(cfg.tracing.sampleRatio >= 0 && cfg.tracing.sampleRatio <= 1, "tracing-sample-ratio", validator.Range(0, 1))
+	v.Check(cfg.idempotency.ttl > 0, "idempotency-ttl", validator.Invalid("min", "must be greater than zero"))
+
+	// Anyone knowing the secret can sign tokens for any user
+	if cfg.env == "production" {
+		v.Check(cfg.jwt.secret != "", "jwt-secret", validator.Required())
+		v.Check(len(cfg.jwt.secret) >= 32, "jwt-secret", validator.MinLength(32))
+		v.Check(cfg.smtp.password != "", "smtp-password", validator.Required())
+	}
+
+	if v.Valid() {
+		return nil
+	}
+
+	problems := []string{}
+
+	for _, name := range slices.Sorted(maps.Keys(v.Errors)) {
+		for _, e := range v.Errors[name] {
+			problems = append(problems, name+" "+e.Message)
+		}
+	}
+
+	return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+}
+
+// printConfig writes the effective config to w as a YAML config file, with
+// the secrets redacted
+func printConfig(w io.Writer, opts loadOptions) error {
+	return yaml.NewEncoder(w).Encode(configValues(opts.flags, true))
+}
+
+// configValues returns the value of every setting loaded into fs, keyed by
+// flag name. With redacted set the secrets are hidden.
+func configValues(fs *flag.FlagSet, redacted bool) map[string]any {
+	values := map[string]any{}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "Environment" || isOption(f.Name) {
+			return
+		}
+
+		var value any = f.Value.String()
+
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+
+		if redacted && slices.Contains(secretFlags, f.Name) {
+			value = redact(f.Name, f.Value.String())
+		}
+
+		values[f.Name] = value
+	})
+
+	return values
+}
+
+// parseLogLevel parses the log level setting, such as "debug"
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(name))
+
+	return level, err
+}
+
+// redact hides a secret setting, leaving only whether it is set. The password
+// of a DSN is hidden but the rest of it is kept.
+func redact(name, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	if name == "db-dsn" {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+
+	return "REDACTED"
+}
+
+// fieldsValue is a list of space separated values
+type fieldsValue []string
+
+func (f *fieldsValue) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *fieldsValue) Set(val string) error {
+	*f = strings.Fields(val)
+	return nil
+}
+
+func (f *fieldsValue) Get() any {
+	return []string(*f)
+}
+
+// routeLimitsValue holds the rate limits of routes, set one
+// "METHOD /pattern=rps,burst" at a time
+type routeLimitsValue map[string]ratelimit.Limit
+
+func (rl routeLimitsValue) String() string {
+	return strings.Join(rl.Get().([]string), " ")
+}
+
+func (rl routeLimitsValue) Set(val string) error {
+	route, limit, err := parseRouteLimit(val)
+
+	if err != nil {
+		return err
+	}
+
+	rl[route] = limit
+	return nil
+}
+
+func (rl routeLimitsValue) Get() any {
+	routes := []string{}
+
+	for _, route := range slices.Sorted(maps.Keys(rl)) {
+		limit := rl[route]
+		routes = append(routes, fmt.Sprintf("%s=%s,%d", route, strconv.FormatFloat(limit.Rate, 'g', -1, 64), limit.Burst))
+	}
+
+	return routes
+}
+
+// parseRouteLimit parses a route limit written as "METHOD /pattern=rps,burst"
+func parseRouteLimit(val string) (string, ratelimit.Limit, error) {
+	route, limit, ok := strings.Cut(val, "=")
+	rps, burst, ok2 := strings.Cut(limit, ",")
+
+	if !ok || !ok2 || len(strings.Fields(route)) != 2 {
+		return "", ratelimit.Limit{}, fmt.Errorf("invalid route limit %q, want \"METHOD /pattern=rps,burst\"", val)
+	}
+
+	r, err := strconv.ParseFloat(rps, 64)
+
+	if err != nil || r <= 0 {
+		return "", ratelimit.Limit{}, fmt.Errorf("invalid rps in route limit %q", val)
+	}
+
+	b, err := strconv.Atoi(burst)
+
+	if err != nil || b < 1 {
+		return "", ratelimit.Limit{}, fmt.Errorf("invalid burst in route limit %q", val)
+	}
+
+	return strings.Join(strings.Fields(route), " "), ratelimit.Limit{Rate: r, Burst: b}, nil
+}
@@ -10,10 +10,21 @@ import (
 type contextKey string
 
 var (
-	contextKeyUser = contextKey("user")
+	contextKeyUser        = contextKey("user")
+	contextKeyRequestID   = contextKey("request_id")
+	contextKeyRequestInfo = contextKey("request_info")
 )
 
+// requestInfo is filled in while a request goes down the middleware chain,
+// for the access log written on its way back up
+type requestInfo struct {
+	route  string
+	userID int64
+}
+
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	app.contextGetRequestInfo(r).userID = user.ID
+
 	ctx := context.WithValue(r.Context(), contextKeyUser, user)
 	return r.WithContext(ctx)
 }
@@ -27,3 +38,32 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), contextKeyRequestID, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the request ID of ctx, which is empty outside
+// of a request. It takes a context so background tasks can read it too.
+func (app *application) contextGetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyRequestID).(string)
+	return id
+}
+
+func (app *application) contextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), contextKeyRequestInfo, info)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestInfo returns the request info, or a throwaway one when the
+// request is not logged
+func (app *application) contextGetRequestInfo(r *http.Request) *requestInfo {
+	info, ok := r.Context().Value(contextKeyRequestInfo).(*requestInfo)
+
+	if !ok {
+		return &requestInfo{}
+	}
+
+	return info
+}
@@ -1,73 +1,209 @@
 package main
 
-import "net/http"
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.chetraseng.com/internal/jsonpatch"
+	"greenlight.chetraseng.com/internal/validator"
+)
 
 func (app *application) logError(r *http.Request, err error) {
 	var (
 		method = r.Method
 		url    = r.URL.RequestURI()
 	)
-	app.logger.Error(err.Error(), "method", method, "url", url)
+	app.requestLogger(r.Context()).Error(err.Error(), "method", method, "url", url)
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	env := envolope{"error": message}
+// problemTypeBase is prefixed to the code of a problem to form its type
+const problemTypeBase = "https://greenlight.chetraseng.com/problems/"
+
+// problem is an RFC 9457 problem details object. Code is stable, clients
+// should match on it rather than on the detail.
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is the failure of a single field of the request
+type fieldError struct {
+	Field string `json:"field"`
+	validator.Error
+}
+
+// errorResponse sends message, either a string or validation errors by
+// field, as an application/problem+json response. With legacy errors enabled
+// the message is sent as {"error": message} instead, with the first error of
+// each top-level field.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message any) {
+	if app.config.legacyErrors {
+		if errs, ok := message.(map[string][]validator.Error); ok {
+			message = legacyValidationErrors(errs)
+		}
+
+		err := app.writeJSON(w, status, envolope{"error": message}, nil)
 
-	err := app.writeJSON(w, status, env, nil)
+		if err != nil {
+			app.logError(r, err)
+			w.WriteHeader(500)
+		}
+
+		return
+	}
+
+	p := problem{
+		Type:     problemTypeBase + strings.ReplaceAll(code, "_", "-"),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: app.contextGetRequestID(r.Context()),
+		Code:     code,
+	}
+
+	switch message := message.(type) {
+	case string:
+		p.Detail = message
+	case map[string][]validator.Error:
+		p.Detail = "the request contains invalid fields"
+
+		for _, field := range slices.Sorted(maps.Keys(message)) {
+			for _, err := range message[field] {
+				p.Errors = append(p.Errors, fieldError{Field: field, Error: err})
+			}
+		}
+	}
+
+	js, err := json.Marshal(p)
 
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
 }
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, "server_error", message)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, "not_found", message)
 }
 
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
-	message := "the reequested resource could not be found"
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
+
+	// Legacy clients may match on the original message
+	if app.config.legacyErrors {
+		message = "the reequested resource could not be found"
+	}
+
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed", message)
 }
 
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+// legacyValidationErrors keeps the first message of every top-level field,
+// keyed by the field name as the legacy format did
+func legacyValidationErrors(errs map[string][]validator.Error) map[string]string {
+	legacy := make(map[string]string, len(errs))
+
+	for _, key := range slices.Sorted(maps.Keys(errs)) {
+		field, _, _ := strings.Cut(strings.TrimPrefix(key, "/"), "/")
+
+		if _, exists := legacy[field]; !exists {
+			legacy[field] = errs[key][0].Message
+		}
+	}
+
+	return legacy
+}
+
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string][]validator.Error) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "failed_validation", errors)
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, http.StatusConflict, "edit_conflict", message)
 }
 
-func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(retryAfter))))
+
 	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorResponse(w, r, http.StatusTooManyRequests, "rate_limit_exceeded", message)
+}
+
+func (app *application) rateLimiterUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the rate limiter is unavailable, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, "rate_limiter_unavailable", message)
 }
 
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
-	app.errorResponse(w, r, http.StatusUnauthorized, "invalid authentication credentials")
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_credentials", "invalid authentication credentials")
 }
 
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("WWW-Authenticate", "Bearer")
-	app.errorResponse(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_authentication_token", "invalid or missing authentication token")
 }
 
 func (app *application) authentiationRequiredResponse(w http.ResponseWriter, r *http.Request) {
-	app.errorResponse(w, r, http.StatusUnauthorized, "you must be authenticated to access this resource")
+	app.errorResponse(w, r, http.StatusUnauthorized, "authentication_required", "you must be authenticated to access this resource")
 }
 
 func (app *application) inActiveAccountResponse(w http.ResponseWriter, r *http.Request) {
-	app.errorResponse(w, r, http.StatusForbidden, "your user account must be activated to access this resource")
+	app.errorResponse(w, r, http.StatusForbidden, "inactive_account", "your user account must be activated to access this resource")
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
-	app.errorResponse(w, r, http.StatusForbidden, "your uses account does not have the necessary permission to access this resource")
+	app.errorResponse(w, r, http.StatusForbidden, "not_permitted", "your uses account does not have the necessary permission to access this resource")
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, contentType string) {
+	message := fmt.Sprintf("the %q content type is not supported by this resource", contentType)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", message)
+}
+
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource is not available in any of the accepted content types"
+	app.errorResponse(w, r, http.StatusNotAcceptable, "not_acceptable", message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since it was last read, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, "precondition_failed", message)
+}
+
+func (app *application) patchConflictResponse(w http.ResponseWriter, r *http.Request, err *jsonpatch.OperationError) {
+	message := fmt.Sprintf("the test at %s failed, the movie does not hold the expected value", err.Path)
+	errs := map[string][]validator.Error{err.Pointer(): {validator.Invalid("test_failed", message)}}
+	app.errorResponse(w, r, http.StatusConflict, "patch_test_failed", errs)
+}
+
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the idempotency key has already been used for a request with another body"
+	app.errorResponse(w, r, http.StatusConflict, "idempotency_key_reused", message)
+}
+
+func (app *application) idempotencyKeyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with the same idempotency key is still being processed, please try again later"
+	app.errorResponse(w, r, http.StatusConflict, "idempotency_key_in_progress", message)
 }
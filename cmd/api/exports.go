@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+const (
+	// Exports of the whole catalogue outlive the server write timeout
+	exportTimeout = 30 * time.Minute
+
+	// Flush the buffered output to the client every this many movies
+	exportFlushEvery = 100
+)
+
+// exportFormats maps the ?format= values to their content type
+var exportFormats = map[string]string{
+	"csv":    "text/csv",
+	"ndjson": "application/x-ndjson",
+	"json":   "application/json",
+}
+
+// movieEncoder writes movies in one export format
+type movieEncoder interface {
+	Begin() error
+	Encode(movie *data.Movie) error
+	End() error
+	Flush() error
+}
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Format string
+		data.MovieFilters
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.Format = app.readString(qs, "format", "")
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+	v.Check(validator.PermittedValue(input.Sort, input.SortSafeList...), "sort", validator.OneOf(input.SortSafeList...))
+
+	data.ValidateMovieFilters(v, input.MovieFilters)
+
+	if input.Format != "" {
+		v.Check(validator.PermittedValue(input.Format, "csv", "ndjson", "json"), "format", validator.OneOf("csv", "ndjson", "json"))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	input.Format = exportFormat(input.Format, r.Header.Get("Accept"))
+
+	if input.Format == "" {
+		app.notAcceptableResponse(w, r)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(exportTimeout))
+
+	var enc movieEncoder
+
+	switch input.Format {
+	case "csv":
+		enc = &csvMovieEncoder{w: csv.NewWriter(w)}
+	case "ndjson":
+		enc = &ndjsonMovieEncoder{w: bufio.NewWriter(w)}
+	default:
+		enc = &jsonMovieEncoder{w: bufio.NewWriter(w)}
+	}
+
+	// Nothing is written before the first row is read, so a failing query can
+	// still be reported with a proper error response
+	started := false
+	count := 0
+
+	begin := func() error {
+		started = true
+
+		w.Header().Set("Content-Type", exportFormats[input.Format])
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.`+input.Format+`"`)
+		w.WriteHeader(http.StatusOK)
+
+		return enc.Begin()
+	}
+
+	err := app.models.Movies.Export(r.Context(), input.MovieFilters, input.Filters, func(movie *data.Movie) error {
+		if !started {
+			err := begin()
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err := enc.Encode(movie)
+
+		if err != nil {
+			return err
+		}
+
+		count++
+
+		if count%exportFlushEvery == 0 {
+			err = enc.Flush()
+
+			if err != nil {
+				return err
+			}
+
+			return rc.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The status line is gone already, all we can do is to log and stop
+		app.logError(r, err)
+		return
+	}
+
+	if !started {
+		err = begin()
+	}
+
+	if err == nil {
+		err = enc.End()
+	}
+
+	if err == nil {
+		err = enc.Flush()
+	}
+
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// exportFormat returns the format of an export: the ?format= value when one
+// was given, whatever the Accept header says, or else the negotiated one
+func exportFormat(format, accept string) string {
+	if format != "" {
+		return format
+	}
+
+	return negotiateExportFormat(accept)
+}
+
+// negotiateExportFormat returns the first export format accepted by the
+// Accept header, JSON when the header is missing, or "" when nothing matches.
+func negotiateExportFormat(accept string) string {
+	if accept == "" {
+		return "json"
+	}
+
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+
+		// A quality of zero rules the type out
+		if err != nil || isZeroQuality(params["q"]) {
+			continue
+		}
+
+		switch mediaType {
+		case "text/csv":
+			return "csv"
+		case "application/x-ndjson", "application/ndjson":
+			return "ndjson"
+		case "application/json", "application/*", "*/*":
+			return "json"
+		}
+	}
+
+	return ""
+}
+
+// isZeroQuality reports whether q is a quality value of zero, such as 0.000
+func isZeroQuality(q string) bool {
+	f, err := strconv.ParseFloat(q, 64)
+	return err == nil && f == 0
+}
+
+// csvMovieEncoder writes movies as CSV with the same columns the import
+// accepts, plus id, created_at and version
+type csvMovieEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvMovieEncoder) Begin() error {
+	return e.w.Write([]string{
+		"id", "created_at", "title", "original_title", "alternate_titles", "synopsis", "language",
+		"year", "runtime", "genres", "version",
+	})
+}
+
+func (e *csvMovieEncoder) Encode(movie *data.Movie) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.CreatedAt.Format(time.RFC3339),
+		movie.Title,
+		movie.OriginalTitle,
+		strings.Join(movie.AlternateTitles, "|"),
+		movie.Synopsis,
+		movie.Language,
+		strconv.Itoa(int(movie.Year)),
+		strconv.Itoa(int(movie.Runtime)),
+		strings.Join(movie.Genres, "|"),
+		strconv.Itoa(int(movie.Version)),
+	})
+}
+
+func (e *csvMovieEncoder) End() error {
+	return nil
+}
+
+func (e *csvMovieEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonMovieEncoder writes one JSON movie per line
+type ndjsonMovieEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *ndjsonMovieEncoder) Begin() error {
+	return nil
+}
+
+func (e *ndjsonMovieEncoder) Encode(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(append(js, '\n'))
+	return err
+}
+
+func (e *ndjsonMovieEncoder) End() error {
+	return nil
+}
+
+func (e *ndjsonMovieEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// jsonMovieEncoder writes a single {"movies": [...]} document, one movie at a
+// time
+type jsonMovieEncoder struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (e *jsonMovieEncoder) Begin() error {
+	_, err := e.w.WriteString(`{"movies":[`)
+	return err
+}
+
+func (e *jsonMovieEncoder) Encode(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+
+	if err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		js = append([]byte{','}, js...)
+	}
+
+	e.count++
+
+	_, err = e.w.Write(js)
+	return err
+}
+
+func (e *jsonMovieEncoder) End() error {
+	_, err := e.w.WriteString("]}\n")
+	return err
+}
+
+func (e *jsonMovieEncoder) Flush() error {
+	return e.w.Flush()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.chetraseng.com/internal/data"
+)
+
+func TestExportFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		want   string
+	}{
+		{name: "no preference", want: "json"},
+		{name: "csv", accept: "text/csv", want: "csv"},
+		{name: "ndjson", accept: "application/x-ndjson", want: "ndjson"},
+		{name: "unregistered ndjson", accept: "application/ndjson", want: "ndjson"},
+		{name: "any type", accept: "*/*", want: "json"},
+		{name: "any application type", accept: "application/*", want: "json"},
+		{name: "first match wins", accept: "image/png, text/csv, application/json", want: "csv"},
+		{name: "parameters", accept: "text/csv; charset=utf-8", want: "csv"},
+		{name: "ruled out", accept: "text/csv;q=0, application/json", want: "json"},
+		{name: "malformed parts skipped", accept: "text/;;, application/x-ndjson", want: "ndjson"},
+		{name: "nothing acceptable", accept: "image/png, text/html", want: ""},
+		{name: "format over accept", format: "csv", accept: "application/json", want: "csv"},
+		{name: "format over unacceptable", format: "ndjson", accept: "image/png", want: "ndjson"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exportFormat(tt.format, tt.accept); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportMoviesHandlerErrors(t *testing.T) {
+	app, _, _ := newTestApplication(t, newLimiterConfig())
+
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   int
+		code   string
+	}{
+		{name: "not acceptable", accept: "image/png", want: http.StatusNotAcceptable},
+		{name: "unknown format", query: "?format=xml", want: http.StatusUnprocessableEntity, code: "one_of"},
+		{name: "unknown format whatever accepted", query: "?format=xml", accept: "text/csv", want: http.StatusUnprocessableEntity, code: "one_of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies/export"+tt.query, nil)
+
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			rr := httptest.NewRecorder()
+			app.exportMoviesHandler(rr, r)
+
+			if rr.Code != tt.want {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.want)
+			}
+
+			if tt.code != "" && !strings.Contains(rr.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Errorf("got body %s; want a %s error", rr.Body, tt.code)
+			}
+		})
+	}
+}
+
+// encodeMovies writes movies with enc as the export handler does, returning
+// what was written to buf
+func encodeMovies(t *testing.T, enc movieEncoder, buf *bytes.Buffer, movies []*data.Movie) string {
+	t.Helper()
+
+	err := enc.Begin()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, movie := range movies {
+		err = enc.Encode(movie)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = enc.End()
+
+	if err == nil {
+		err = enc.Flush()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+var testExportMovies = []*data.Movie{
+	{
+		ID:              1,
+		CreatedAt:       time.Date(2025, 3, 4, 10, 20, 30, 0, time.UTC),
+		Title:           `Dr. Strangelove, or: How I Learned to Stop Worrying`,
+		AlternateTitles: []string{"Dr. Strangelove", `The "Bomb"`},
+		Synopsis:        "A general goes mad.\nThe world ends.",
+		Language:        "english",
+		Year:            1964,
+		Runtime:         95,
+		Genres:          []string{"comedy", "war"},
+		Version:         2,
+	},
+	{
+		ID:        2,
+		CreatedAt: time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC),
+		Title:     "Casablanca",
+		Language:  "english",
+		Year:      1942,
+		Runtime:   102,
+		Genres:    []string{"drama"},
+		Version:   1,
+	},
+}
+
+func TestCSVMovieEncoder(t *testing.T) {
+	var buf bytes.Buffer
+
+	out := encodeMovies(t, &csvMovieEncoder{w: csv.NewWriter(&buf)}, &buf, testExportMovies)
+
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v\n%s", err, out)
+	}
+
+	want := [][]string{
+		{"id", "created_at", "title", "original_title", "alternate_titles", "synopsis", "language", "year", "runtime", "genres", "version"},
+		{"1", "2025-03-04T10:20:30Z", `Dr. Strangelove, or: How I Learned to Stop Worrying`, "", `Dr. Strangelove|The "Bomb"`, "A general goes mad.\nThe world ends.", "english", "1964", "95", "comedy|war", "2"},
+		{"2", "2025-03-05T00:00:00Z", "Casablanca", "", "", "", "english", "1942", "102", "drama", "1"},
+	}
+
+	if len(records) != len(want) {
+		t.Fatalf("got %d records; want %d\n%s", len(records), len(want), out)
+	}
+
+	for i := range want {
+		if strings.Join(records[i], "\x00") != strings.Join(want[i], "\x00") {
+			t.Errorf("record %d: got %q; want %q", i, records[i], want[i])
+		}
+	}
+
+	// Commas, quotes and newlines are quoted
+	if !strings.Contains(out, `"Dr. Strangelove, or: How I Learned to Stop Worrying"`) ||
+		!strings.Contains(out, `"Dr. Strangelove|The ""Bomb"""`) {
+		t.Errorf("fields not quoted:\n%s", out)
+	}
+}
+
+func TestCSVMovieEncoderEmpty(t *testing.T) {
+	var buf bytes.Buffer
+
+	out := encodeMovies(t, &csvMovieEncoder{w: csv.NewWriter(&buf)}, &buf, nil)
+
+	if out != "id,created_at,title,original_title,alternate_titles,synopsis,language,year,runtime,genres,version\n" {
+		t.Errorf("got %q; want the header alone", out)
+	}
+}
+
+func TestNDJSONMovieEncoder(t *testing.T) {
+	var buf bytes.Buffer
+
+	out := encodeMovies(t, &ndjsonMovieEncoder{w: bufio.NewWriter(&buf)}, &buf, testExportMovies)
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+
+	if len(lines) != len(testExportMovies) {
+		t.Fatalf("got %d lines; want %d\n%s", len(lines), len(testExportMovies), out)
+	}
+
+	for i, line := range lines {
+		var movie data.Movie
+
+		err := json.Unmarshal([]byte(line), &movie)
+
+		if err != nil {
+			t.Fatalf("line %d is not JSON: %v", i+1, err)
+		}
+
+		if movie.ID != testExportMovies[i].ID || movie.Title != testExportMovies[i].Title {
+			t.Errorf("line %d: got movie %d %q", i+1, movie.ID, movie.Title)
+		}
+	}
+
+	buf.Reset()
+
+	if out := encodeMovies(t, &ndjsonMovieEncoder{w: bufio.NewWriter(&buf)}, &buf, nil); out != "" {
+		t.Errorf("got %q for no movies; want nothing", out)
+	}
+}
+
+func TestJSONMovieEncoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		movies []*data.Movie
+	}{
+		{name: "no movies", movies: nil},
+		{name: "one movie", movies: testExportMovies[:1]},
+		{name: "movies", movies: testExportMovies},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			out := encodeMovies(t, &jsonMovieEncoder{w: bufio.NewWriter(&buf)}, &buf, tt.movies)
+
+			var doc struct {
+				Movies []data.Movie `json:"movies"`
+			}
+
+			err := json.Unmarshal([]byte(out), &doc)
+
+			if err != nil {
+				t.Fatalf("export is not JSON: %v\n%s", err, out)
+			}
+
+			// An empty export is an empty list, not null
+			if doc.Movies == nil || len(doc.Movies) != len(tt.movies) {
+				t.Errorf("got movies %v; want %d\n%s", doc.Movies, len(tt.movies), out)
+			}
+
+			if len(tt.movies) == 0 && out != "{\"movies\":[]}\n" {
+				t.Errorf("got %q", out)
+			}
+		})
+	}
+}
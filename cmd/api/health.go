@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"greenlight.chetraseng.com/internal/data"
+)
+
+// readinessCacheTTL is how long readiness results are reused, so frequent
+// probes from several load balancers do not hammer the dependencies
+const readinessCacheTTL = 2 * time.Second
+
+// healthCheck is a dependency the API can not serve requests without. The
+// check fails when it returns an error or runs past its timeout.
+type healthCheck struct {
+	name    string
+	timeout time.Duration
+	check   func(ctx context.Context) error
+}
+
+type checkResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// readiness runs the health checks and caches their results
+type readiness struct {
+	checks []healthCheck
+
+	// shuttingDown is set as soon as the server starts shutting down, from
+	// then on the API reports itself as not ready
+	shuttingDown atomic.Bool
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	ready     bool
+	results   map[string]checkResult
+}
+
+func newReadiness(checks ...healthCheck) *readiness {
+	return &readiness{checks: checks}
+}
+
+// check runs every check concurrently, or returns the cached results when
+// they are recent enough. Concurrent callers wait for a single run.
+func (rd *readiness) check(ctx context.Context) (bool, map[string]checkResult) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	if time.Since(rd.checkedAt) < readinessCacheTTL {
+		return rd.ready, rd.results
+	}
+
+	var (
+		wg      sync.WaitGroup
+		resMu   sync.Mutex
+		ready   = true
+		results = make(map[string]checkResult, len(rd.checks))
+	)
+
+	// Results are shared between probes, one giving up must not fail them
+	ctx = context.WithoutCancel(ctx)
+
+	for _, hc := range rd.checks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := runCheck(ctx, hc)
+
+			result := checkResult{Status: "ok", Duration: time.Since(start).String()}
+
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+			}
+
+			resMu.Lock()
+			defer resMu.Unlock()
+
+			results[hc.name] = result
+			ready = ready && err == nil
+		}()
+	}
+
+	wg.Wait()
+
+	rd.checkedAt = time.Now()
+	rd.ready = ready
+	rd.results = results
+
+	return ready, results
+}
+
+// runCheck runs hc under its timeout. Checks which do not honour the context
+// are abandoned once it expires.
+func runCheck(ctx context.Context, hc healthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- hc.check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// livezHandler reports that the process is up and serving requests. It
+// checks no dependency, a failing database is no reason to restart the API.
+func (app *application) livezHandler(w http.ResponseWriter, r *http.Request) {
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+
+	err := app.writeJSON(w, http.StatusOK, envolope{"status": "alive"}, headers)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readyzHandler returns the handler reporting whether the API can serve
+// requests. The errors of failed checks are only included when verbose is
+// set, as they give away internal addresses.
+func (app *application) readyzHandler(verbose bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		headers := make(http.Header)
+		headers.Set("Cache-Control", "no-store")
+
+		if app.readiness.shuttingDown.Load() {
+			err := app.writeJSON(w, http.StatusServiceUnavailable, envolope{"status": "shutting_down"}, headers)
+
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ready, results := app.readiness.check(r.Context())
+
+		status, body := http.StatusOK, "ready"
+
+		if !ready {
+			status, body = http.StatusServiceUnavailable, "not_ready"
+		}
+
+		checks := make(map[string]checkResult, len(results))
+
+		for name, result := range results {
+			if !verbose {
+				result.Error = ""
+			}
+
+			checks[name] = result
+		}
+
+		err := app.writeJSON(w, status, envolope{"status": body, "checks": checks}, headers)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// healthChecks returns the checks readiness is made of: the database can be
+// reached, its schema is the one the binary was built for and, optionally,
+// the SMTP server can be dialled
+func (app *application) healthChecks(db *sql.DB) []healthCheck {
+	checks := []healthCheck{
+		{name: "database", timeout: 2 * time.Second, check: db.PingContext},
+		{name: "migrations", timeout: 2 * time.Second, check: func(ctx context.Context) error {
+			version, dirty, err := app.models.Schema.Version(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			if dirty {
+				return fmt.Errorf("migration %d is dirty", version)
+			}
+
+			if version != data.SchemaVersion {
+				return fmt.Errorf("database is at migration %d, expected %d", version, data.SchemaVersion)
+			}
+
+			return nil
+		}},
+	}
+
+	if app.config.health.smtp {
+		checks = append(checks, healthCheck{name: "smtp", timeout: 5 * time.Second, check: func(context.Context) error {
+			return app.mailer.Load().Ping()
+		}})
+	}
+
+	return checks
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"maps"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/trace"
 	"greenlight.chetraseng.com/internal/validator"
 )
 
@@ -109,9 +115,42 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+// etag returns the strong entity tag of a versioned resource. The version is
+// bumped on every change, so id and version identify a representation.
+func etag(id int64, version int32) string {
+	return fmt.Sprintf(`"%d-%d"`, id, version)
+}
+
+// etagMatches reports whether tag is listed in the value of an If-Match or,
+// when weak is set, an If-None-Match header. "*" matches any tag. If-Match
+// uses the strong comparison, so weak tags never match it.
+func etagMatches(header, tag string, weak bool) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Returns a JSON response to client with bad request status code
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, "bad_request", err.Error())
 }
 
 // Reads a string parameter from the query string and returns the default value if not found
@@ -149,29 +188,115 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	i, err := strconv.Atoi(value)
 
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddError(key, validator.Type("integer"))
 	}
 
 	return i
 }
 
-// background accept a function as parameter
-// and start a new go routine with the function as well as panic recovery
-func (app *application) background(fn func()) {
+// readBool reads a string parameter and parse it to bool and returns the default value if not found.
+// Add error message to the validator if the value is not a valid bool
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+
+	if err != nil {
+		v.AddError(key, validator.Type("boolean"))
+	}
+
+	return b
+}
+
+// readTime reads a string parameter and parse it as either a RFC 3339 timestamp
+// or a 2006-01-02 date and returns the default value if not found. A date
+// is read as the start of the day, or of the next day when nextDay is set,
+// for exclusive upper bounds.
+// Add error message to the validator if the value is not a valid time
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, nextDay bool, v *validator.Validator) time.Time {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+
+	if err == nil {
+		return t
+	}
+
+	t, err = time.Parse(time.DateOnly, value)
+
+	if err != nil {
+		v.AddError(key, validator.Invalid("format", "must be a RFC 3339 timestamp or a YYYY-MM-DD date"))
+		return defaultValue
+	}
+
+	if nextDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t
+}
+
+// background runs fn in a goroutine the server waits for on shutdown. fn gets
+// the context of r without its cancellation, so the task outlives the
+// request but keeps its request ID.
+func (app *application) background(r *http.Request, fn func(ctx context.Context)) {
+	ctx := context.WithoutCancel(r.Context())
+
 	app.wg.Add(1)
 	// Start a new routine with panic recovery and background function
 	go func() {
 		defer app.wg.Done()
 
+		ctx, span := startBackgroundSpan(ctx)
+		defer span.End()
+
 		// Recover from panic in same go routine
 		defer func() {
 			if err := recover(); err != nil {
-				app.logger.Error(fmt.Sprintf("%v", err))
+				app.requestLogger(ctx).Error(fmt.Sprintf("%v", err))
 			}
 
 		}()
 
-		fn()
+		fn(ctx)
 	}()
 
 }
+
+// requestLogger returns the logger of the request ctx belongs to, along with
+// the trace of its span
+func (app *application) requestLogger(ctx context.Context) *slog.Logger {
+	logger := app.logger
+
+	if id := app.contextGetRequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID().String())
+	}
+
+	return logger
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+
+	// Read does not fail on the platforms Go supports, a failure is fatal
+	if err != nil {
+		panic(fmt.Errorf("reading a random request ID: %w", err))
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+func TestReadTime(t *testing.T) {
+	app := &application{}
+	fallback := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		nextDay bool
+		want    time.Time
+		valid   bool
+	}{
+		{name: "unset", value: "", want: fallback, valid: true},
+		{name: "timestamp", value: "2025-03-04T10:20:30Z", want: time.Date(2025, 3, 4, 10, 20, 30, 0, time.UTC), valid: true},
+		{name: "timestamp as upper bound", value: "2025-03-04T10:20:30Z", nextDay: true, want: time.Date(2025, 3, 4, 10, 20, 30, 0, time.UTC), valid: true},
+		{name: "date", value: "2025-03-04", want: time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC), valid: true},
+		{name: "date as upper bound", value: "2025-03-04", nextDay: true, want: time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC), valid: true},
+		{name: "last day of the year", value: "2024-12-31", nextDay: true, want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), valid: true},
+		{name: "invalid", value: "04/03/2025", want: fallback, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			got := app.readTime(url.Values{"created_to": {tt.value}}, "created_to", fallback, tt.nextDay, v)
+
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v", v.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/tomasen/realip"
+	"greenlight.chetraseng.com/internal/data"
+)
+
+// maxIdempotentBody bounds the body of a request made with an idempotency
+// key, which is read in full to fingerprint it
+const maxIdempotentBody = 1_048_576
+
+// replayedHeaders are the headers of a stored response sent back on retries.
+// They are the ones set by the handlers, the headers set by the middleware
+// describe the request at hand, such as its ID or rate limit.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// idempotencyRecorder passes a response through while keeping a copy of it
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		rec.header = make(http.Header)
+
+		for _, name := range replayedHeaders {
+			if values := rec.Header().Values(name); len(values) > 0 {
+				rec.header[name] = slices.Clone(values)
+			}
+		}
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// idempotent makes retries of a request sent with the same Idempotency-Key
+// header safe. The first request is handled and its response stored, retries
+// get the stored response back. Keys are scoped to the route and the user,
+// or the client IP of anonymous requests, and reusing one with another body
+// is a conflict. Server errors are not stored, so the request can be retried.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+
+		if idempotencyKey == "" {
+			next(w, r)
+			return
+		}
+
+		if len(idempotencyKey) > 255 {
+			app.badRequestResponse(w, r, errors.New("the Idempotency-Key header must not be more than 255 bytes long"))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if len(body) > maxIdempotentBody {
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxIdempotentBody))
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := "ip:" + realip.FromRequest(r)
+
+		if user := app.contextGetUser(r); !user.IsAnonymousUser() {
+			scope = fmt.Sprintf("user:%d", user.ID)
+		}
+
+		fingerprint := sha256.Sum256(body)
+
+		key := &data.IdempotencyKey{
+			Scope:       scope,
+			Route:       r.Method + " " + r.URL.Path,
+			Key:         idempotencyKey,
+			Fingerprint: fingerprint[:],
+		}
+
+		existing, err := app.models.IdempotencyKeys.Begin(r.Context(), key, app.config.idempotency.ttl)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case !bytes.Equal(existing.Fingerprint, key.Fingerprint):
+				app.idempotencyKeyReusedResponse(w, r)
+			case existing.Status == 0:
+				app.idempotencyKeyInProgressResponse(w, r)
+			default:
+				// Keys stored by earlier versions hold every header of the
+				// response, so the headers are filtered again
+				for _, name := range replayedHeaders {
+					if values := http.Header(existing.Header).Values(name); len(values) > 0 {
+						w.Header()[name] = values
+					}
+				}
+
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+
+		// The key is released if the handler panics or fails, otherwise every
+		// retry would be turned down as in progress
+		defer func() {
+			if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+				err := app.models.IdempotencyKeys.Release(context.WithoutCancel(r.Context()), key)
+
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		next(rec, r)
+
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			return
+		}
+
+		key.Status = rec.status
+		key.Header = rec.header
+		key.Body = rec.body.Bytes()
+
+		err = app.models.IdempotencyKeys.Complete(context.WithoutCancel(r.Context()), key)
+
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys every hour
+func (app *application) purgeIdempotencyKeys() {
+	for range time.Tick(time.Hour) {
+		err := app.models.IdempotencyKeys.DeleteExpired(context.Background())
+
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/images"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+const (
+	// Images are much larger than the JSON bodies readJSON is limited to
+	maxImageBytes = 10 << 20
+
+	// Uploading an image and its thumbnails takes longer than the server
+	// read and write timeouts allow
+	imageTimeout = time.Minute
+)
+
+// imageSizes holds the width of every thumbnail by image kind and size name
+var imageSizes = map[string]map[string]int{
+	data.ImagePoster:   {"small": 185, "medium": 342, "large": 780},
+	data.ImageBackdrop: {"small": 300, "medium": 780, "large": 1280},
+}
+
+// uploadMovieImageHandler returns the handler storing the poster or backdrop,
+// as named by kind, of a movie. The image is sent either as the "image" field
+// of a multipart form or as the raw request body.
+func (app *application) uploadMovieImageHandler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.ReadIDParam(r)
+
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		// Do not bother reading the upload of a movie which does not exist
+		_, err = app.models.Movies.Get(r.Context(), id)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Now().Add(imageTimeout))
+		_ = rc.SetWriteDeadline(time.Now().Add(imageTimeout))
+
+		body, err := app.readImage(w, r)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, errUnsupportedImageUpload):
+				app.unsupportedMediaTypeResponse(w, r, r.Header.Get("Content-Type"))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		img, format, err := images.Decode(body)
+
+		if err != nil {
+			code := "format"
+
+			if errors.Is(err, images.ErrTooLarge) {
+				code = "max_pixels"
+			}
+
+			v := validator.New()
+			v.AddError("image", validator.Invalid(code, err.Error()))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), imageTimeout)
+		defer cancel()
+
+		// Every upload gets keys of its own, so cached copies of the previous
+		// image are never served in its place
+		prefix := fmt.Sprintf("movies/%d/%s/%d", id, kind, time.Now().UnixNano())
+
+		stored := &data.Image{
+			Keys: map[string]string{},
+			URLs: map[string]string{},
+		}
+
+		ext := format
+
+		if ext == "jpeg" {
+			ext = "jpg"
+		}
+
+		err = app.storeImage(ctx, stored, "original", prefix+"/original."+ext, body, images.ContentTypes[format])
+
+		for name, width := range imageSizes[kind] {
+			if err != nil {
+				break
+			}
+
+			var thumbnail []byte
+
+			thumbnail, err = images.Thumbnail(img, width)
+
+			if err == nil {
+				err = app.storeImage(ctx, stored, name, prefix+"/"+name+".jpg", thumbnail, "image/jpeg")
+			}
+		}
+
+		if err != nil {
+			app.deleteImage(context.WithoutCancel(r.Context()), stored)
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		previous, err := app.models.Movies.SetImage(r.Context(), id, kind, stored)
+
+		if err != nil {
+			app.deleteImage(context.WithoutCancel(r.Context()), stored)
+
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if previous != nil {
+			app.background(r, func(ctx context.Context) {
+				app.deleteImage(ctx, previous)
+			})
+		}
+
+		movie, err := app.models.Movies.Get(r.Context(), id)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("ETag", etag(movie.ID, movie.Version))
+
+		err = app.writeJSON(w, http.StatusOK, envolope{"movie": movie}, headers)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+var errUnsupportedImageUpload = errors.New("unsupported image upload")
+
+// readImage reads the uploaded image, from the "image" field of a multipart
+// form or from the raw request body, up to maxImageBytes
+func (app *application) readImage(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil {
+		return nil, errUnsupportedImageUpload
+	}
+
+	// Leave some room for the multipart boundaries and headers
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+64*1024)
+
+	var src io.Reader
+
+	switch {
+	case mediaType == "multipart/form-data":
+		mr, err := r.MultipartReader()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			part, err := mr.NextPart()
+
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("body must contain an image field")
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if part.FormName() == "image" {
+				src = part
+				break
+			}
+		}
+
+	case strings.HasPrefix(mediaType, "image/"):
+		src = r.Body
+
+	default:
+		return nil, errUnsupportedImageUpload
+	}
+
+	body, err := io.ReadAll(io.LimitReader(src, maxImageBytes+1))
+
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("image must not be larger than %d bytes", maxImageBytes)
+		}
+
+		return nil, err
+	}
+
+	if len(body) > maxImageBytes {
+		return nil, fmt.Errorf("image must not be larger than %d bytes", maxImageBytes)
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("image must not be empty")
+	}
+
+	return body, nil
+}
+
+// storeImage puts one size of an image into the storage and records it
+func (app *application) storeImage(ctx context.Context, img *data.Image, name, key string, body []byte, contentType string) error {
+	err := app.storage.Put(ctx, key, body, contentType)
+
+	if err != nil {
+		return err
+	}
+
+	img.Keys[name] = key
+	img.URLs[name] = app.storage.URL(key)
+
+	return nil
+}
+
+// deleteImage removes every size of an image from the storage. Failures are
+// logged only, a leftover file does no harm.
+func (app *application) deleteImage(ctx context.Context, img *data.Image) {
+	ctx, cancel := context.WithTimeout(ctx, imageTimeout)
+	defer cancel()
+
+	for _, key := range img.Keys {
+		err := app.storage.Delete(ctx, key)
+
+		if err != nil {
+			app.requestLogger(ctx).Error(err.Error(), "key", key)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+const (
+	// Imports are streamed so they can be much larger than a regular JSON body
+	maxImportBytes = 64 << 20
+
+	// Stop collecting row errors after this many, the rest are only counted
+	maxImportErrors = 1000
+
+	// Imports take longer than the server read and write timeouts allow
+	importTimeout = 5 * time.Minute
+)
+
+// importRowError reports why a single record of an import was rejected
+type importRowError struct {
+	Line   int                          `json:"line"`
+	Errors map[string][]validator.Error `json:"errors"`
+}
+
+// importReport summarises the result of an import
+type importReport struct {
+	DryRun          bool             `json:"dry_run"`
+	Mode            string           `json:"mode"`
+	Rows            int              `json:"rows"`
+	Valid           int              `json:"valid"`
+	Inserted        int              `json:"inserted"`
+	Errors          []importRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+func (rep *importReport) addError(line int, errs map[string][]validator.Error) {
+	if len(rep.Errors) >= maxImportErrors {
+		rep.ErrorsTruncated = true
+		return
+	}
+
+	rep.Errors = append(rep.Errors, importRowError{Line: line, Errors: errs})
+}
+
+// movieDecoder reads movie records one by one from an import body.
+// Decode returns io.EOF once the input is exhausted. A record which can not be
+// parsed is reported through problems rather than err, so the import can go on.
+type movieDecoder interface {
+	Decode() (line int, movie *data.Movie, problems map[string][]validator.Error, err error)
+}
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	mode := app.readString(qs, "mode", "atomic")
+
+	v.Check(validator.PermittedValue(mode, "atomic", "best_effort"), "mode", validator.OneOf("atomic", "best_effort"))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil {
+		app.unsupportedMediaTypeResponse(w, r, r.Header.Get("Content-Type"))
+		return
+	}
+
+	// Give the client enough time to upload and wait for the whole import
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(importTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(importTimeout))
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var dec movieDecoder
+
+	switch mediaType {
+	case "text/csv":
+		dec, err = newCSVMovieDecoder(body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	case "application/x-ndjson", "application/ndjson":
+		dec = newNDJSONMovieDecoder(body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, mediaType)
+		return
+	}
+
+	report := importReport{
+		DryRun: dryRun,
+		Mode:   mode,
+		Errors: []importRowError{},
+	}
+
+	var importer *data.MovieImporter
+
+	if !dryRun {
+		importer, err = app.models.Movies.NewImporter(r.Context(), mode == "atomic")
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.runImport(dec, importer, &report)
+
+	if err != nil {
+		if importer != nil {
+			_ = importer.Rollback()
+		}
+
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		case errors.Is(err, errBadImport):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	status := http.StatusOK
+
+	if importer != nil {
+		// Atomic imports are all-or-nothing, a single bad row discards everything
+		if mode == "atomic" && len(report.Errors) > 0 {
+			err = importer.Rollback()
+			status = http.StatusUnprocessableEntity
+		} else {
+			err = importer.Commit()
+		}
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		report.Inserted = importer.Inserted
+	}
+
+	err = app.writeJSON(w, status, envolope{"import": report}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runImport validates every record and hands the valid ones to importer.
+// A nil importer means a dry run, records are validated only.
+func (app *application) runImport(dec movieDecoder, importer *data.MovieImporter, report *importReport) error {
+	for {
+		line, movie, problems, err := dec.Decode()
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		report.Rows++
+
+		if problems != nil {
+			report.addError(line, problems)
+			continue
+		}
+
+		v := validator.New()
+
+		if data.ValidateMovie(v, movie); !v.Valid() {
+			report.addError(line, v.Errors)
+			continue
+		}
+
+		report.Valid++
+
+		// Nothing will be committed for an atomic import once a row failed
+		if importer == nil || (report.Mode == "atomic" && len(report.Errors) > 0) {
+			continue
+		}
+
+		err = importer.Add(movie)
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var errBadImport = errors.New("body contains an invalid import")
+
+// csvMovieDecoder decodes CSV records with a header row naming the columns
+// title, year, runtime and genres, and optionally original_title,
+// alternate_titles, synopsis and language. Genres and alternate titles are
+// separated by "|" and the runtime is either a number of minutes or the
+// "<n> mins" form used in JSON.
+type csvMovieDecoder struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVMovieDecoder(r io.Reader) (*csvMovieDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, fmt.Errorf("%w: unable to read CSV header: %s", errBadImport, err)
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !validator.PermittedValue(name, "title", "year", "runtime", "genres", "original_title", "alternate_titles", "synopsis", "language") {
+			return nil, fmt.Errorf("%w: unknown CSV column %q", errBadImport, name)
+		}
+
+		columns[name] = i
+	}
+
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing CSV column %q", errBadImport, name)
+		}
+	}
+
+	return &csvMovieDecoder{reader: reader, columns: columns}, nil
+}
+
+func (d *csvMovieDecoder) Decode() (int, *data.Movie, map[string][]validator.Error, error) {
+	record, err := d.reader.Read()
+
+	if err != nil {
+		var parseError *csv.ParseError
+
+		// A malformed row is reported and the import carries on with the next one
+		if errors.As(err, &parseError) {
+			return parseError.StartLine, nil, recordErrors("", validator.Invalid("malformed", parseError.Err.Error())), nil
+		}
+
+		return 0, nil, nil, err
+	}
+
+	line, _ := d.reader.FieldPos(0)
+	problems := validator.New()
+
+	movie := &data.Movie{
+		Title:  record[d.columns["title"]],
+		Genres: splitCSVList(record[d.columns["genres"]]),
+	}
+
+	if i, ok := d.columns["original_title"]; ok {
+		movie.OriginalTitle = record[i]
+	}
+
+	if i, ok := d.columns["alternate_titles"]; ok {
+		movie.AlternateTitles = splitCSVList(record[i])
+	}
+
+	if i, ok := d.columns["synopsis"]; ok {
+		movie.Synopsis = record[i]
+	}
+
+	if i, ok := d.columns["language"]; ok {
+		movie.Language = strings.TrimSpace(record[i])
+	}
+
+	year, err := strconv.ParseInt(strings.TrimSpace(record[d.columns["year"]]), 10, 32)
+
+	if err != nil {
+		problems.AddError("/year", validator.Type("integer"))
+	}
+
+	movie.Year = int32(year)
+
+	runtime := strings.TrimSuffix(strings.TrimSpace(record[d.columns["runtime"]]), " mins")
+	minutes, err := strconv.ParseInt(runtime, 10, 32)
+
+	if err != nil {
+		problems.AddError("/runtime", validator.Invalid("format", "must be a number of minutes"))
+	}
+
+	movie.Runtime = data.Runtime(minutes)
+
+	if !problems.Valid() {
+		return line, nil, problems.Errors, nil
+	}
+
+	return line, movie, nil, nil
+}
+
+// recordErrors returns the problems of a record which failed with err
+func recordErrors(key string, err validator.Error) map[string][]validator.Error {
+	return map[string][]validator.Error{key: {err}}
+}
+
+// splitCSVList splits a "|" separated CSV field, dropping empty values
+func splitCSVList(field string) []string {
+	values := []string{}
+
+	for value := range strings.SplitSeq(field, "|") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// ndjsonMovieDecoder decodes one JSON movie object per line, using the same
+// fields as the create movie endpoint. Blank lines are skipped.
+type ndjsonMovieDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONMovieDecoder(r io.Reader) *ndjsonMovieDecoder {
+	scanner := bufio.NewScanner(r)
+
+	// Allow a single record to be as large as a regular JSON body
+	scanner.Buffer(make([]byte, 64*1024), 1_048_576)
+
+	return &ndjsonMovieDecoder{scanner: scanner}
+}
+
+func (d *ndjsonMovieDecoder) Decode() (int, *data.Movie, map[string][]validator.Error, error) {
+	for d.scanner.Scan() {
+		d.line++
+
+		record := bytes.TrimSpace(d.scanner.Bytes())
+
+		if len(record) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title           string       `json:"title"`
+			OriginalTitle   string       `json:"original_title"`
+			AlternateTitles []string     `json:"alternate_titles"`
+			Synopsis        string       `json:"synopsis"`
+			Language        string       `json:"language"`
+			Year            int32        `json:"year"`
+			Runtime         data.Runtime `json:"runtime"`
+			Genres          []string     `json:"genres"`
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(record))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+
+		if err != nil {
+			var unmarshalTypeError *json.UnmarshalTypeError
+
+			switch {
+			case errors.Is(err, data.ErrInvalidRuntimeFormat):
+				return d.line, nil, recordErrors("/runtime", validator.Invalid("format", err.Error())), nil
+			case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+				return d.line, nil, recordErrors(validator.Pointer(unmarshalTypeError.Field), validator.Type(unmarshalTypeError.Type.Kind().String())), nil
+			default:
+				return d.line, nil, recordErrors("", validator.Invalid("malformed", err.Error())), nil
+			}
+		}
+
+		movie := &data.Movie{
+			Title:           input.Title,
+			OriginalTitle:   input.OriginalTitle,
+			AlternateTitles: input.AlternateTitles,
+			Synopsis:        input.Synopsis,
+			Language:        input.Language,
+			Year:            input.Year,
+			Runtime:         input.Runtime,
+			Genres:          input.Genres,
+		}
+
+		return d.line, movie, nil, nil
+	}
+
+	err := d.scanner.Err()
+
+	if errors.Is(err, bufio.ErrTooLong) {
+		return 0, nil, nil, fmt.Errorf("%w: line %d is longer than %d bytes", errBadImport, d.line+1, 1_048_576)
+	}
+
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return 0, nil, nil, io.EOF
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+// rowErrors returns the keys and codes of the errors of each line
+func rowErrors(errs []importRowError) map[int]map[string]string {
+	rows := map[int]map[string]string{}
+
+	for _, row := range errs {
+		rows[row.Line] = map[string]string{}
+
+		for key, keyErrors := range row.Errors {
+			codes := []string{}
+
+			for _, err := range keyErrors {
+				codes = append(codes, err.Code)
+			}
+
+			rows[row.Line][key] = strings.Join(codes, ",")
+		}
+	}
+
+	return rows
+}
+
+func TestRunImportCSV(t *testing.T) {
+	body := strings.Join([]string{
+		"title,year,runtime,genres,alternate_titles,language",
+		"Casablanca,1942,102,drama|romance,,english",
+		`"Dr. Strangelove, or: How I Learned to Stop Worrying",1964,95 mins,comedy | war,Dr. Strangelove|,`,
+		"Metropolis,nineteen,153,sci-fi,,",
+		"Nosferatu,1922,ninety,horror,,",
+		`"Broken "quote",1990,90,drama,,`,
+		"Untitled,1800,90,,,klingon",
+		"Jaws,1975,124,thriller|thriller,,",
+		"\"A title\nover two lines\",2000,90,drama,,",
+		"Too,few,fields",
+		"Seven Samurai,1954,207,action|drama,,",
+	}, "\n")
+
+	dec, err := newCSVMovieDecoder(strings.NewReader(body))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := importReport{Mode: "best_effort", Errors: []importRowError{}}
+
+	err = (&application{}).runImport(dec, nil, &report)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The title over two lines is one record, reported by its first line
+	if report.Rows != 10 || report.Valid != 4 {
+		t.Errorf("got %d rows, %d valid; want 10 rows, 4 valid", report.Rows, report.Valid)
+	}
+
+	want := map[int]map[string]string{
+		4:  {"/year": "type"},
+		5:  {"/runtime": "format"},
+		6:  {"": "malformed"},
+		7:  {"/year": "min", "/genres": "min_items", "/language": "one_of"},
+		8:  {"/genres": "unique"},
+		11: {"": "malformed"},
+	}
+
+	if got := rowErrors(report.Errors); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %v; want %v", got, want)
+	}
+}
+
+func TestCSVMovieDecoderRecord(t *testing.T) {
+	body := "Title, Year,RUNTIME,genres,original_title,alternate_titles,synopsis,language\n" +
+		`Dr. Strangelove,1964,95 mins,comedy| war|,Dr. Strangelove,"Doctor Strangelove|The ""Bomb""","Ends
+badly", english ` + "\n"
+
+	dec, err := newCSVMovieDecoder(strings.NewReader(body))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	line, movie, problems, err := dec.Decode()
+
+	if err != nil || problems != nil {
+		t.Fatalf("got error %v, problems %v", err, problems)
+	}
+
+	want := &data.Movie{
+		Title:           "Dr. Strangelove",
+		OriginalTitle:   "Dr. Strangelove",
+		AlternateTitles: []string{"Doctor Strangelove", `The "Bomb"`},
+		Synopsis:        "Ends\nbadly",
+		Language:        "english",
+		Year:            1964,
+		Runtime:         95,
+		Genres:          []string{"comedy", "war"},
+	}
+
+	if line != 2 {
+		t.Errorf("got line %d; want 2", line)
+	}
+
+	if !reflect.DeepEqual(movie, want) {
+		t.Errorf("got movie %+v; want %+v", movie, want)
+	}
+}
+
+func TestCSVMovieDecoderHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "empty", body: "", want: "body must not be empty"},
+		{name: "unknown column", body: "title,year,runtime,genres,budget\n", want: `unknown CSV column "budget"`},
+		{name: "missing column", body: "title,year,genres\n", want: `missing CSV column "runtime"`},
+		{name: "malformed header", body: "title,\"year\n", want: "unable to read CSV header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newCSVMovieDecoder(strings.NewReader(tt.body))
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v; want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunImportNDJSON(t *testing.T) {
+	body := strings.Join([]string{
+		`{"title":"Casablanca","year":1942,"runtime":"102 mins","genres":["drama"]}`,
+		``,
+		`{"title":"Metropolis","year":"1927","runtime":"153 mins","genres":["sci-fi"]}`,
+		`{"title":"Nosferatu","year":1922,"runtime":"94","genres":["horror"]}`,
+		`{"title":"Jaws","year":1975,"runtime":"124 mins","genres":["thriller"],"budget":9}`,
+		`{"title":"Jaws`,
+		`   `,
+		`{"title":"","year":1975,"runtime":"124 mins","genres":["thriller",""]}`,
+		`{"title":"Seven Samurai","year":1954,"runtime":"207 mins","genres":["action","drama"]}`,
+	}, "\n")
+
+	report := importReport{Mode: "atomic", Errors: []importRowError{}}
+
+	err := (&application{}).runImport(newNDJSONMovieDecoder(strings.NewReader(body)), nil, &report)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Blank lines are neither rows nor errors, but they are counted as lines
+	if report.Rows != 7 || report.Valid != 2 {
+		t.Errorf("got %d rows, %d valid; want 7 rows, 2 valid", report.Rows, report.Valid)
+	}
+
+	want := map[int]map[string]string{
+		3: {"/year": "type"},
+		4: {"/runtime": "format"},
+		5: {"": "malformed"},
+		6: {"": "malformed"},
+		8: {"/title": "required", "/genres/1": "required"},
+	}
+
+	if got := rowErrors(report.Errors); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %v; want %v", got, want)
+	}
+}
+
+func TestNDJSONMovieDecoderTooLong(t *testing.T) {
+	body := `{"title":"` + strings.Repeat("x", 1_048_576) + `"}`
+
+	report := importReport{Errors: []importRowError{}}
+
+	err := (&application{}).runImport(newNDJSONMovieDecoder(strings.NewReader(body)), nil, &report)
+
+	if !errors.Is(err, errBadImport) {
+		t.Errorf("got error %v; want %v", err, errBadImport)
+	}
+}
+
+func TestImportReportTruncated(t *testing.T) {
+	var report importReport
+
+	for line := range maxImportErrors + 5 {
+		report.addError(line, map[string][]validator.Error{"": {validator.Required()}})
+	}
+
+	if len(report.Errors) != maxImportErrors || !report.ErrorsTruncated {
+		t.Errorf("got %d errors, truncated %t; want %d, truncated", len(report.Errors), report.ErrorsTruncated, maxImportErrors)
+	}
+}
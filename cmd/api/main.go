@@ -3,19 +3,22 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"runtime"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
 	"greenlight.chetraseng.com/internal/data"
 	"greenlight.chetraseng.com/internal/mailer"
+	"greenlight.chetraseng.com/internal/ratelimit"
+	"greenlight.chetraseng.com/internal/storage"
 	"greenlight.chetraseng.com/internal/vcs"
 )
 
@@ -24,18 +27,26 @@ var (
 )
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port     int
+	env      string
+	logLevel string
+	db       struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  time.Duration
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps       float64
+		burst     int
+		userRPS   float64
+		userBurst int
+		enabled   bool
+		store     string
+		failOpen  bool
+
+		// routes holds the limits of the expensive routes by "METHOD /path"
+		routes map[string]ratelimit.Limit
 	}
 	smtp struct {
 		host     string
@@ -50,61 +61,135 @@ type config struct {
 	jwt struct {
 		secret string
 	}
+	// admin holds the address of the listener serving metrics, profiles and
+	// health probes, empty to disable it
+	admin struct {
+		addr string
+	}
+	server struct {
+		idleTimeout  time.Duration
+		readTimeout  time.Duration
+		writeTimeout time.Duration
+	}
+	// tls serves the API over HTTPS when both certFile and keyFile are set.
+	// The certificate is reloaded whenever either file changes on disk.
+	tls struct {
+		certFile   string
+		keyFile    string
+		minVersion string
+		http2      bool
+		// redirectAddr is the address of the listener redirecting plain
+		// HTTP requests to HTTPS, empty to disable it
+		redirectAddr string
+		hstsMaxAge   time.Duration
+	}
+	health struct {
+		smtp bool
+		// drainDelay is how long the API keeps serving once it reports
+		// itself as not ready on shutdown
+		drainDelay time.Duration
+	}
+	// legacyErrors sends errors as {"error": message} rather than as
+	// problem details, for clients which have not migrated yet
+	legacyErrors bool
+
+	idempotency struct {
+		ttl time.Duration
+	}
+
+	tracing struct {
+		exporter    string
+		endpoint    string
+		file        string
+		sampleRatio float64
+	}
+
+	storage struct {
+		backend   string
+		dir       string
+		publicURL string
+		s3        struct {
+			endpoint  string
+			region    string
+			bucket    string
+			accessKey string
+			secretKey string
+			pathStyle bool
+		}
+	}
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	// config is the config the server was started with. The settings which
+	// are reloaded on SIGHUP must be read through app.liveConfig instead.
+	config   config
+	live     atomic.Pointer[config]
+	logger   *slog.Logger
+	logLevel *slog.LevelVar
+	models   data.Models
+	mailer   atomic.Pointer[mailer.Mailer]
+	storage  storage.Storage
+	limiter  ratelimit.Store
+
+	// preLimiter holds the per-IP counts of preRateLimit, and routeKeys the
+	// method and pattern of every route, which route limits are keyed by
+	preLimiter ratelimit.Store
+	routeKeys  map[string]bool
+
+	// args and values are the command line the config is reloaded from and
+	// the raw values of the settings in effect, for logging what a reload
+	// changes
+	args   []string
+	values map[string]any
+
+	// promMetrics holds the collectors served at /metrics
+	promMetrics *promMetrics
+	readiness   *readiness
+	wg          sync.WaitGroup
 }
 
 func main() {
-	var cfg config
+	cfg, opts, err := loadConfig(os.Args[1:])
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 
-	// Read config from environment variable flags
-	flag.IntVar(&cfg.port, "port", 4000, "API Server port")
-	flag.StringVar(&cfg.env, "Environment", "development", "Environment (development|staging|production)")
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	// Read db config settings
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+	if opts.displayVersion {
+		fmt.Printf("Version:\t%s\n", version)
+		os.Exit(0)
+	}
 
-	// Read limiter
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum request per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
-	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	if opts.printConfig {
+		err = printConfig(os.Stdout, opts)
 
-	// Read SMTP config
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
-	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", "0cdb05f1e34c8b", "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", "hehe-password", "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.chetraseng.com>", "SMTP sender")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-	// Read JWT secret
-	flag.StringVar(&cfg.jwt.secret, "jwt-secret", "", "JWT secret")
+		os.Exit(0)
+	}
 
-	// Read cors trusted origins
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
-		cfg.cors.trustedOrigins = strings.Fields(val)
-		return nil
-	})
+	// Validated by loadConfig
+	level, _ := parseLogLevel(cfg.logLevel)
 
-	// Displaying version
-	displayVersion := flag.Bool("version", false, "Display version and exit")
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
 
-	flag.Parse()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
 
-	if *displayVersion {
-		fmt.Printf("Version:\t%s\n", version)
-		os.Exit(0)
-	}
+	shutdownTracer, err := openTracer(cfg)
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 
 	db, err := openDB(cfg)
 
@@ -117,6 +202,13 @@ func main() {
 
 	logger.Info("database connection pool established")
 
+	store, err := openStorage(cfg)
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	expvar.NewString("version").Set(version)
 
 	// Publish number of active goroutine
@@ -134,15 +226,42 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	limiter, err := openLimiter(cfg, db, logger)
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	app := application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModel(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:   cfg,
+		logger:   logger,
+		logLevel: logLevel,
+		models:   data.NewModel(db),
+		storage:  store,
+		limiter:  limiter,
+		args:     os.Args[1:],
+		values:   configValues(opts.flags, false),
+
+		preLimiter:  ratelimit.NewMemory(),
+		promMetrics: newPromMetrics(db),
 	}
 
+	app.live.Store(&cfg)
+	app.setMailer(cfg)
+
+	app.readiness = newReadiness(app.healthChecks(db)...)
+
 	err = app.server()
 
+	// Flush the spans of the requests and tasks which have just finished
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if shutdownErr := shutdownTracer(ctx); shutdownErr != nil {
+		logger.Error(shutdownErr.Error())
+	}
+
 	if err != nil {
 
 		logger.Error(err.Error())
@@ -168,3 +287,39 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func openStorage(cfg config) (storage.Storage, error) {
+	switch cfg.storage.backend {
+	case "local":
+		publicURL := cfg.storage.publicURL
+
+		if publicURL == "" {
+			publicURL = fmt.Sprintf("%s://localhost:%d/media", cfg.scheme(), cfg.port)
+		}
+
+		return storage.NewLocal(cfg.storage.dir, publicURL)
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.storage.s3.endpoint,
+			Region:    cfg.storage.s3.region,
+			Bucket:    cfg.storage.s3.bucket,
+			AccessKey: cfg.storage.s3.accessKey,
+			SecretKey: cfg.storage.s3.secretKey,
+			PathStyle: cfg.storage.s3.pathStyle,
+			PublicURL: cfg.storage.publicURL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
+
+func openLimiter(cfg config, db *sql.DB, logger *slog.Logger) (ratelimit.Store, error) {
+	switch cfg.limiter.store {
+	case "memory":
+		return ratelimit.NewMemory(), nil
+	case "postgres":
+		return ratelimit.NewPostgres(db, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter store %q", cfg.limiter.store)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// promMetrics holds the Prometheus collectors of the API. Labels only ever
+// take a bounded set of values, the route label is the httprouter pattern
+// rather than the raw path so every movie ID does not become a series.
+type promMetrics struct {
+	registry            *prometheus.Registry
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	mailerSends         *prometheus.CounterVec
+	rateLimitRejections *prometheus.CounterVec
+}
+
+func newPromMetrics(db *sql.DB) *promMetrics {
+	m := &promMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "greenlight_http_requests_total",
+			Help: "Number of HTTP requests handled, by method, route and status class.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "greenlight_http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests, by method, route and status class.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		mailerSends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "greenlight_mailer_sends_total",
+			Help: "Number of emails sent, by template and result.",
+		}, []string{"template", "result"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "greenlight_rate_limit_rejections_total",
+			Help: "Number of requests rejected by the rate limiter, by policy.",
+		}, []string{"policy"}),
+	}
+
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "greenlight_build_info",
+		Help:        "Version of the running API, the value is always 1.",
+		ConstLabels: prometheus.Labels{"version": version},
+	})
+	buildInfo.Set(1)
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.mailerSends,
+		m.rateLimitRejections,
+		buildInfo,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "greenlight"),
+	)
+
+	return m
+}
+
+// handler serves the metrics in the Prometheus text format
+func (m *promMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// sendMail sends an email through the mailer, under a span of its own, and
+// counts the result
+func (app *application) sendMail(ctx context.Context, recipient, templateFile string, data any) error {
+	_, span := tracer.Start(ctx, "mailer.Send", trace.WithAttributes(attribute.String("mailer.template", templateFile)))
+	defer span.End()
+
+	err := app.mailer.Load().Send(recipient, templateFile, data)
+
+	result := "success"
+
+	if err != nil {
+		result = "failure"
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	app.promMetrics.mailerSends.WithLabelValues(templateFile, result).Inc()
+
+	return err
+}
+
+// observeRequest records a handled request. Requests which matched no route
+// are grouped together, as are methods the API does not use.
+func (m *promMetrics) observeRequest(method, route string, status int, seconds float64) {
+	if route == "" {
+		route = "unmatched"
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		method = "other"
+	}
+
+	class := strconv.Itoa(status/100) + "xx"
+
+	m.requests.WithLabelValues(method, route, class).Inc()
+	m.requestDuration.WithLabelValues(method, route, class).Observe(seconds)
+}
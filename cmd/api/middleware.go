@@ -5,22 +5,23 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/pascaldekloe/jwt"
 	"github.com/tomasen/realip"
-	"golang.org/x/time/rate"
 	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/ratelimit"
 )
 
 type metricsResponseWriter struct {
 	wrapped       http.ResponseWriter
 	statusCode    int
 	headerWritten bool
+	bytesWritten  int
 }
 
 func newMetricsRespondWriter(w http.ResponseWriter) *metricsResponseWriter {
@@ -45,13 +46,60 @@ func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
 
 func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 	mw.headerWritten = true
-	return mw.wrapped.Write(b)
+	n, err := mw.wrapped.Write(b)
+	mw.bytesWritten += n
+	return n, err
 }
 
 func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
 	return mw.wrapped
 }
 
+// requestIDPattern restricts the request IDs accepted from clients
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID tags the request with the X-Request-ID sent by the client, or a
+// new one, and returns it in the response. It also starts the request info
+// the rest of the chain fills in.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		r = app.contextSetRequestID(r, id)
+
+		next.ServeHTTP(w, app.contextSetRequestInfo(r, &requestInfo{}))
+	})
+}
+
+// logRequest writes an access log line once the request has been handled
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		mw := newMetricsRespondWriter(w)
+
+		next.ServeHTTP(mw, r)
+
+		info := app.contextGetRequestInfo(r)
+
+		app.requestLogger(r.Context()).Info("request",
+			"method", r.Method,
+			"route", info.route,
+			"status", mw.statusCode,
+			"bytes", mw.bytesWritten,
+			"duration", time.Since(start),
+			"user_id", info.userID,
+			"ip", realip.FromRequest(r),
+		)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -65,62 +113,106 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// rateLimit runs behind the router, so the pattern of the matched route is
+// known to rateLimitPolicy
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := app.liveConfig()
 
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
+		// Only apply rate limit when it's enabled
+		if cfg.limiter.enabled {
+			key, limit := app.rateLimitPolicy(r, cfg)
 
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+			if !app.allowRequest(w, r, cfg, app.limiter, key, limit) {
+				return
+			}
+		}
 
-	go func() {
+		next.ServeHTTP(w, r)
+	})
+}
 
-		for {
-			time.Sleep(time.Minute)
+// preRateLimit counts requests with credentials against the IP address of
+// the client, at the limit of authenticated users, before authenticate looks
+// their user up in the database. The counts are kept in memory, as a cheap
+// first check ahead of the configured store.
+func (app *application) preRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := app.liveConfig()
 
-			// Cleaning up map, so need to lock
-			mu.Lock()
+		if cfg.limiter.enabled && r.Header.Get("Authorization") != "" {
+			key := "auth:" + realip.FromRequest(r)
+			limit := ratelimit.Limit{Rate: cfg.limiter.userRPS, Burst: cfg.limiter.userBurst}
 
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
+			if !app.allowRequest(w, r, cfg, app.preLimiter, key, limit) {
+				return
 			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRequest counts the request under key in store and reports whether it
+// may go on. Otherwise the response has been sent already.
+func (app *application) allowRequest(w http.ResponseWriter, r *http.Request, cfg *config, store ratelimit.Store, key string, limit ratelimit.Limit) bool {
+	result, err := store.Allow(r.Context(), key, limit)
 
-			mu.Unlock()
+	if err != nil {
+		app.logError(r, err)
+
+		// Requests go through unchecked while the store is down, unless the
+		// limiter fails closed
+		if !cfg.limiter.failOpen {
+			app.rateLimiterUnavailableResponse(w, r)
+			return false
 		}
-	}()
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only apply rate limit when it's enabled
+		return true
+	}
 
-		if app.config.limiter.enabled {
-			// Check if the rate is allowed
-			ip := realip.FromRequest(r)
+	// Headers of the IETF RateLimit header fields draft
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
 
-			mu.Lock() // Lock this mutex to prevent this code from excuting concurrently
+	if !result.Allowed {
+		policy, _, _ := strings.Cut(key, ":")
+		app.promMetrics.rateLimitRejections.WithLabelValues(policy).Inc()
 
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
-			}
+		app.rateLimitExceededResponse(w, r, result.RetryAfter)
+		return false
+	}
 
-			clients[ip].lastSeen = time.Now()
+	return true
+}
 
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				app.rateLimitExceededResponse(w, r)
-				return
-			}
+// rateLimitPolicy returns the key the request is counted under and its
+// limit. Authenticated users are counted by ID, anyone else by IP. Routes
+// with a limit of their own, keyed by method and pattern, are counted apart
+// from the rest of the API. The limits are read from cfg, so a request sees a
+// single version of them.
+func (app *application) rateLimitPolicy(r *http.Request, cfg *config) (string, ratelimit.Limit) {
+	key := "ip:" + realip.FromRequest(r)
+	limit := ratelimit.Limit{Rate: cfg.limiter.rps, Burst: cfg.limiter.burst}
+
+	if user := app.contextGetUser(r); !user.IsAnonymousUser() {
+		key = fmt.Sprintf("user:%d", user.ID)
+		limit = ratelimit.Limit{Rate: cfg.limiter.userRPS, Burst: cfg.limiter.userBurst}
+	}
 
-			mu.Unlock()
-		}
+	route := r.Method + " " + app.contextGetRequestInfo(r).route
 
-		next.ServeHTTP(w, r)
-	})
+	if routeLimit, ok := cfg.limiter.routes[route]; ok {
+		return "route:" + route + ":" + key, routeLimit
+	}
+
+	return key, limit
+}
+
+// ceilSeconds rounds d up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
 }
 
 func (app *application) authenticate(next http.Handler) http.Handler {
@@ -143,7 +235,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		headerParts := strings.Split(authorizationHeader, " ")
 
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.authenticationFailed(w, r)
 			return
 		}
 
@@ -155,22 +247,22 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 
 		if err != nil {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.authenticationFailed(w, r)
 			return
 		}
 
 		if !claims.Valid(time.Now()) {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.authenticationFailed(w, r)
 			return
 		}
 
 		if claims.Issuer != "greenlight.chetraseng.com" {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.authenticationFailed(w, r)
 			return
 		}
 
 		if !claims.AcceptAudience("greenlight.chetraseng.com") {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.authenticationFailed(w, r)
 			return
 		}
 
@@ -181,11 +273,11 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.Get(userID)
+		user, err := app.models.Users.Get(r.Context(), userID)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
-				app.invalidAuthenticationTokenResponse(w, r)
+				app.authenticationFailed(w, r)
 			default:
 				app.serverErrorResponse(w, r, err)
 			}
@@ -197,6 +289,25 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticationFailed turns down a request whose token is invalid. Such
+// requests never reach rateLimit, so they are counted against the IP address
+// of the client first, and guessing tokens is rate limited like any other
+// anonymous request.
+func (app *application) authenticationFailed(w http.ResponseWriter, r *http.Request) {
+	cfg := app.liveConfig()
+
+	if cfg.limiter.enabled {
+		key := "ip:" + realip.FromRequest(r)
+		limit := ratelimit.Limit{Rate: cfg.limiter.rps, Burst: cfg.limiter.burst}
+
+		if !app.allowRequest(w, r, cfg, app.limiter, key, limit) {
+			return
+		}
+	}
+
+	app.invalidAuthenticationTokenResponse(w, r)
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -229,7 +340,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
 
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
@@ -254,13 +365,14 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 
 		origin := r.Header.Get("Origin")
 
-		if origin != "" && slices.Contains(app.config.cors.trustedOrigins, origin) {
+		if origin != "" && slices.Contains(app.liveConfig().cors.trustedOrigins, origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Location, Idempotent-Replayed, X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 
 			// Check for preflight request
 			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
 				w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key, If-Match, If-None-Match, X-Request-ID")
 
 				// Write a 200 OK response without going through the rest of the handler chain
 				w.WriteHeader(http.StatusOK)
@@ -297,7 +409,9 @@ func (app *application) metrics(next http.Handler) http.Handler {
 		// Add response count by status
 		totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
 
-		duration := time.Since(start).Microseconds()
-		totalProcessingTimeMicroseconds.Add(duration)
+		duration := time.Since(start)
+		totalProcessingTimeMicroseconds.Add(duration.Microseconds())
+
+		app.promMetrics.observeRequest(r.Method, app.contextGetRequestInfo(r).route, mw.statusCode, duration.Seconds())
 	})
 }
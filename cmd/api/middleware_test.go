@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"greenlight.chetraseng.com/internal/ratelimit"
+)
+
+var (
+	testAppOnce    sync.Once
+	testApp        *application
+	testAppHandler http.Handler
+	testAppLogs    bytes.Buffer
+)
+
+// newTestApplication returns the routes of an application limiting requests
+// with cfg, along with what it logs. The routes publish expvar variables, so
+// a single application is built and its config and limiters are replaced.
+func newTestApplication(t *testing.T, cfg config) (*application, http.Handler, *bytes.Buffer) {
+	t.Helper()
+
+	testAppOnce.Do(func() {
+		testApp = &application{
+			logger:      slog.New(slog.NewTextHandler(&testAppLogs, nil)),
+			promMetrics: newPromMetrics(nil),
+		}
+
+		testApp.live.Store(&cfg)
+		testAppHandler = testApp.routes()
+	})
+
+	testApp.config = cfg
+	testApp.live.Store(&cfg)
+	testApp.limiter = ratelimit.NewMemory()
+	testApp.preLimiter = ratelimit.NewMemory()
+	testAppLogs.Reset()
+
+	return testApp, testAppHandler, &testAppLogs
+}
+
+func newLimiterConfig() config {
+	var cfg config
+
+	cfg.limiter.enabled = true
+	cfg.limiter.failOpen = true
+	cfg.limiter.rps = 100
+	cfg.limiter.burst = 100
+	cfg.limiter.userRPS = 100
+	cfg.limiter.userBurst = 100
+	cfg.limiter.routes = map[string]ratelimit.Limit{}
+
+	return cfg
+}
+
+func TestRateLimitRoutePattern(t *testing.T) {
+	cfg := newLimiterConfig()
+	cfg.limiter.routes["PATCH /v1/movies/:id"] = ratelimit.Limit{Rate: 0.001, Burst: 1}
+
+	_, handler, _ := newTestApplication(t, cfg)
+
+	// Requests are anonymous, so they are turned down once past the limiter
+	steps := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodPatch, path: "/v1/movies/1", want: http.StatusUnauthorized},
+		{method: http.MethodPatch, path: "/v1/movies/1", want: http.StatusTooManyRequests},
+		{method: http.MethodPatch, path: "/v1/movies/2", want: http.StatusTooManyRequests},
+		{method: http.MethodDelete, path: "/v1/movies/1", want: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/v1/movies/1", want: http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(step.method, step.path, nil))
+
+		if rr.Code != step.want {
+			t.Errorf("%s %s: got status %d; want %d", step.method, step.path, rr.Code, step.want)
+		}
+	}
+}
+
+func TestRateLimitUnmatchedRoutes(t *testing.T) {
+	cfg := newLimiterConfig()
+	cfg.limiter.burst = 1
+
+	_, handler, _ := newTestApplication(t, cfg)
+
+	for _, want := range []int{http.StatusNotFound, http.StatusTooManyRequests} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/nowhere", nil))
+
+		if rr.Code != want {
+			t.Errorf("got status %d; want %d", rr.Code, want)
+		}
+	}
+}
+
+func TestPreRateLimit(t *testing.T) {
+	cfg := newLimiterConfig()
+	cfg.limiter.userBurst = 2
+
+	_, handler, _ := newTestApplication(t, cfg)
+
+	// Invalid tokens never reach the database, but are counted all the same
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r.Header.Set("Authorization", "Bearer not-a-token")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		if rr.Code != want {
+			t.Errorf("request %d: got status %d; want %d", i, rr.Code, want)
+		}
+	}
+
+	// Anonymous requests are not counted by the pre-limit
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/movies", nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous request: got status %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCheckRouteLimits(t *testing.T) {
+	cfg := newLimiterConfig()
+	cfg.limiter.routes["POST /v1/movies/import"] = ratelimit.Limit{Rate: 1, Burst: 1}
+	cfg.limiter.routes["PATCH /v1/movies/1"] = ratelimit.Limit{Rate: 1, Burst: 1}
+
+	app, _, logs := newTestApplication(t, cfg)
+	app.checkRouteLimits(&cfg)
+
+	if !strings.Contains(logs.String(), `route="PATCH /v1/movies/1"`) {
+		t.Errorf("unknown route not reported:\n%s", logs)
+	}
+
+	if strings.Contains(logs.String(), "/v1/movies/import") {
+		t.Errorf("registered route reported:\n%s", logs)
+	}
+}
@@ -3,7 +3,12 @@ package main
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"greenlight.chetraseng.com/internal/data"
 	"greenlight.chetraseng.com/internal/validator"
@@ -14,10 +19,14 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// This prevent unwanted values from being stored in the struct such as ID
 	// It also make sure to get only the allowed data
 	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
+		Title           string       `json:"title"`
+		OriginalTitle   string       `json:"original_title"`
+		AlternateTitles []string     `json:"alternate_titles"`
+		Synopsis        string       `json:"synopsis"`
+		Language        string       `json:"language"`
+		Year            int32        `json:"year"`
+		Runtime         data.Runtime `json:"runtime"`
+		Genres          []string     `json:"genres"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -29,10 +38,14 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	// Manually copy data from input into struct
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:           input.Title,
+		OriginalTitle:   input.OriginalTitle,
+		AlternateTitles: input.AlternateTitles,
+		Synopsis:        input.Synopsis,
+		Language:        input.Language,
+		Year:            input.Year,
+		Runtime:         input.Runtime,
+		Genres:          input.Genres,
 	}
 
 	v := validator.New()
@@ -42,7 +55,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(r.Context(), movie)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -52,6 +65,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// Update location in header
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", etag(movie.ID, movie.Version))
 
 	err = app.writeJSON(w, http.StatusCreated, envolope{"movie": movie}, headers)
 
@@ -64,16 +78,41 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	id, err := app.ReadIDParam(r)
 
 	if err != nil {
-		http.NotFound(w, r)
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	// With If-Match the movie is only deleted at the version the client has
+	// seen, otherwise it is deleted whatever its version
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		movie, err := app.models.Movies.Get(r.Context(), id)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !etagMatches(ifMatch, etag(movie.ID, movie.Version), false) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+
+		err = app.models.Movies.DeleteVersion(r.Context(), movie.ID, movie.Version)
+	} else {
+		err = app.models.Movies.Delete(r.Context(), id)
+	}
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -95,7 +134,7 @@ func (app *application) updateMovieHanlder(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 
 	if err != nil {
 
@@ -109,20 +148,83 @@ func (app *application) updateMovieHanlder(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Refuse to touch a movie which changed since the client read it
+	ifMatch := r.Header.Get("If-Match")
+
+	if ifMatch != "" && !etagMatches(ifMatch, etag(movie.ID, movie.Version), false) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	// The body is either a patch document or the legacy partial movie
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case mergePatchType, jsonPatchType:
+		if !app.patchMovie(w, r, movie, mediaType) {
+			return
+		}
+	case "", "application/json":
+		if !app.readMovieUpdate(w, r, movie) {
+			return
+		}
+	default:
+		app.unsupportedMediaTypeResponse(w, r, mediaType)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Update(r.Context(), movie)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && ifMatch != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(movie.ID, movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envolope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieUpdate applies a partial movie sent as application/json to movie.
+// Fields missing from the body are kept, so none of them can be cleared.
+func (app *application) readMovieUpdate(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
 	// Use point to avoid default value as "" or 0
 	var input struct {
-		Title   *string
-		Year    *int32
-		Runtime *data.Runtime
-		Genres  []string
+		Title           *string       `json:"title"`
+		OriginalTitle   *string       `json:"original_title"`
+		AlternateTitles []string      `json:"alternate_titles"`
+		Synopsis        *string       `json:"synopsis"`
+		Language        *string       `json:"language"`
+		Year            *int32        `json:"year"`
+		Runtime         *data.Runtime `json:"runtime"`
+		Genres          []string      `json:"genres"`
 	}
 
-	err = app.readJSON(w, r, &input)
+	err := app.readJSON(w, r, &input)
 
 	if err != nil {
 
 		app.badRequestResponse(w, r, err)
-		return
+		return false
 	}
 
 	// Manually checking each field
@@ -131,6 +233,22 @@ func (app *application) updateMovieHanlder(w http.ResponseWriter, r *http.Reques
 		movie.Title = *input.Title
 	}
 
+	if input.OriginalTitle != nil {
+		movie.OriginalTitle = *input.OriginalTitle
+	}
+
+	if input.AlternateTitles != nil {
+		movie.AlternateTitles = input.AlternateTitles
+	}
+
+	if input.Synopsis != nil {
+		movie.Synopsis = *input.Synopsis
+	}
+
+	if input.Language != nil {
+		movie.Language = *input.Language
+	}
+
 	if input.Year != nil {
 		movie.Year = *input.Year
 	}
@@ -143,96 +261,186 @@ func (app *application) updateMovieHanlder(w http.ResponseWriter, r *http.Reques
 		movie.Genres = input.Genres
 	}
 
+	return true
+}
+
+func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	projection := app.readProjection(r.URL.Query(), data.MovieFieldSafeList, data.MovieExpandSafeList, v)
+
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	movie, err := app.models.Movies.GetProjected(r.Context(), id, projection)
 
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
+		return
+	}
 
+	headers := make(http.Header)
+	headers.Set("ETag", projectedETag(movie.ID, movie.Version, projection))
+
+	// The client already holds the current representation
+	if etagMatches(r.Header.Get("If-None-Match"), headers.Get("ETag"), true) {
+		maps.Copy(w.Header(), headers)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	projected, err := app.projectMovies([]*data.Movie{movie}, projection)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envolope{"movie": movie}, nil)
+	err = app.writeJSON(w, http.StatusOK, envolope{"movie": projected[0]}, headers)
+
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.ReadIDParam(r)
+func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Facets []string
+		data.MovieFilters
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Facets = app.readCSV(qs, "facets", []string{})
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime", "-relevance"}
+	input.After = app.readString(qs, "after", "")
+	input.Before = app.readString(qs, "before", "")
+	input.SkipTotal = !app.readBool(qs, "include_total", true, v)
+	input.Projection = app.readProjection(qs, data.MovieFieldSafeList, data.MovieExpandSafeList, v)
+
+	// Only the most relevant first order is useful, so sort=relevance is
+	// read as -relevance. sort=-rank is another name for it.
+	if input.Sort == "relevance" || input.Sort == "-rank" {
+		input.Sort = "-relevance"
+	}
+
+	v.Check(input.Sort != "-relevance" || input.Title != "", "sort", validator.Invalid("requires_title", "relevance sort requires a title"))
+
+	data.ValidateMovieFilters(v, input.MovieFilters)
+	data.ValidateFacets(v, input.Facets)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.MovieFilters, input.Filters)
 
 	if err != nil {
-		http.NotFound(w, r)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	projected, err := app.projectMovies(movies, input.Projection)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envolope{"movies": projected, "metadata": metadata}
+
+	// Facets are only counted when asked for, they cost a query of their own
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movies.GetFacets(r.Context(), input.MovieFilters, input.Facets)
+
+		if err != nil {
 			app.serverErrorResponse(w, r, err)
+			return
 		}
-		return
+
+		env["facets"] = facets
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envolope{"movie": movie}, nil)
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
-		data.Filters
+		Query string
+		Limit int
 	}
 
 	v := validator.New()
 
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	input.Page = app.readInt(qs, "page", 1, v)
-	input.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Sort = app.readString(qs, "sort", "id")
-	input.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Query = strings.TrimSpace(app.readString(qs, "q", ""))
+	input.Limit = app.readInt(qs, "limit", 10, v)
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+	v.Check(input.Query != "", "q", validator.Required())
+	v.Check(len(input.Query) <= 100, "q", validator.MaxLength(100))
+	v.Check(validator.Between(input.Limit, 1, 20), "limit", validator.Range(1, 20))
+
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(
-		input.Title,
-		input.Genres,
-		input.Filters,
-	)
+	suggestions, err := app.models.Movies.Suggest(r.Context(), input.Query, input.Limit)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envolope{"movies": movies, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envolope{"suggestions": suggestions}, nil)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// readMovieFilters reads the movie filters shared by the list and export
+// endpoints from the query string
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) data.MovieFilters {
+	return data.MovieFilters{
+		Title:         app.readString(qs, "title", ""),
+		SearchMode:    app.readString(qs, "search_mode", "fulltext"),
+		Language:      app.readString(qs, "search_language", "simple"),
+		Genres:        app.readCSV(qs, "genres", []string{}),
+		GenresMode:    app.readString(qs, "genres_mode", "all"),
+		ExcludeGenres: app.readCSV(qs, "exclude_genres", []string{}),
+		YearMin:       app.readInt(qs, "year_min", 0, v),
+		YearMax:       app.readInt(qs, "year_max", 0, v),
+		RuntimeMin:    app.readInt(qs, "runtime_min", 0, v),
+		RuntimeMax:    app.readInt(qs, "runtime_max", 0, v),
+		CreatedFrom:   app.readTime(qs, "created_from", time.Time{}, false, v),
+		CreatedTo:     app.readTime(qs, "created_to", time.Time{}, true, v),
+	}
+}
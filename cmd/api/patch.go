@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/jsonpatch"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// movieDocument is the JSON document patches are applied to. Every field is
+// present, so it can be replaced, removed or tested. The id and version can
+// only be tested.
+type movieDocument struct {
+	ID              int64        `json:"id"`
+	Title           string       `json:"title"`
+	OriginalTitle   string       `json:"original_title"`
+	AlternateTitles []string     `json:"alternate_titles"`
+	Synopsis        string       `json:"synopsis"`
+	Language        string       `json:"language"`
+	Year            int32        `json:"year"`
+	Runtime         data.Runtime `json:"runtime"`
+	Genres          []string     `json:"genres"`
+	Version         int32        `json:"version"`
+}
+
+// patchMovie applies the merge patch or JSON patch in the request body to
+// movie. A removed field is cleared.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie, mediaType string) bool {
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	doc, err := json.Marshal(&movieDocument{
+		ID:              movie.ID,
+		Title:           movie.Title,
+		OriginalTitle:   movie.OriginalTitle,
+		AlternateTitles: append([]string{}, movie.AlternateTitles...),
+		Synopsis:        movie.Synopsis,
+		Language:        movie.Language,
+		Year:            movie.Year,
+		Runtime:         movie.Runtime,
+		Genres:          append([]string{}, movie.Genres...),
+		Version:         movie.Version,
+	})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if mediaType == mergePatchType {
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		doc, err = jsonpatch.Apply(doc, patch)
+	}
+
+	if err != nil {
+		var opErr *jsonpatch.OperationError
+
+		switch {
+		case errors.As(err, &opErr) && errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchConflictResponse(w, r, opErr)
+		case errors.As(err, &opErr):
+			v := validator.New()
+			v.AddError(opErr.Pointer(), validator.Error{
+				Code:    operationErrorCode(opErr),
+				Message: fmt.Sprintf("%s %s: %v", opErr.Op, opErr.Path, opErr.Err),
+				Params:  map[string]any{"op": opErr.Op, "path": opErr.Path},
+			})
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, jsonpatch.ErrInvalidPatch):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return false
+	}
+
+	var patched movieDocument
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&patched)
+
+	v := validator.New()
+
+	if err != nil {
+		patchedDocumentErrors(v, err)
+	} else {
+		v.Check(patched.ID == movie.ID, "/id", validator.Invalid("read_only", "must not be changed"))
+		v.Check(patched.Version == movie.Version, "/version", validator.Invalid("read_only", "must not be changed"))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	movie.Title = patched.Title
+	movie.OriginalTitle = patched.OriginalTitle
+	movie.AlternateTitles = patched.AlternateTitles
+	movie.Synopsis = patched.Synopsis
+	movie.Language = patched.Language
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return true
+}
+
+// operationErrorCode returns the validation error code of a failed operation
+func operationErrorCode(err *jsonpatch.OperationError) string {
+	switch {
+	case errors.Is(err, jsonpatch.ErrPathNotFound):
+		return "path_not_found"
+	case errors.Is(err, jsonpatch.ErrInvalidPointer):
+		return "invalid_pointer"
+	default:
+		return "invalid_operation"
+	}
+}
+
+// patchedDocumentErrors records why a patched document is not a movie
+func patchedDocumentErrors(v *validator.Validator, err error) {
+	var unmarshalTypeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+		v.AddError(validator.Pointer(unmarshalTypeError.Field), validator.Type(unmarshalTypeError.Type.Kind().String()))
+	case errors.Is(err, data.ErrInvalidRuntimeFormat):
+		v.AddError("/runtime", validator.Invalid("format", `must be formatted as "<minutes> mins"`))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		v.AddError(validator.Pointer(field), validator.Invalid("unknown_field", "is not a movie field"))
+	default:
+		v.AddError("", validator.Invalid("invalid", "patched document is not a movie"))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"slices"
+	"strings"
+
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+// movieExpanders load a resource related to movies, by the name it is
+// requested with in ?expand=. Each returns the resource of every movie by id.
+// Every name of data.MovieExpandSafeList must have one.
+var movieExpanders = map[string]func(app *application, ids []int64) (map[int64]any, error){}
+
+// readProjection reads the fields and expand parameters from the query string
+func (app *application) readProjection(qs url.Values, fieldSafeList, expandSafeList []string, v *validator.Validator) data.Projection {
+	p := data.Projection{
+		Fields:         app.readCSV(qs, "fields", []string{}),
+		FieldSafeList:  fieldSafeList,
+		Expand:         app.readCSV(qs, "expand", []string{}),
+		ExpandSafeList: expandSafeList,
+	}
+
+	data.ValidateProjection(v, p)
+
+	return p
+}
+
+// projectedETag returns the entity tag of the representation of a resource
+// restricted to p. Each projection is a representation of its own, so the
+// normalised projection is folded into the tag, while the full one keeps the
+// tag If-Match is checked against.
+func projectedETag(id int64, version int32, p data.Projection) string {
+	if len(p.Fields) == 0 && len(p.Expand) == 0 {
+		return etag(id, version)
+	}
+
+	fields, expand := slices.Sorted(slices.Values(p.Fields)), slices.Sorted(slices.Values(p.Expand))
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "fields=%s;expand=%s", strings.Join(fields, ","), strings.Join(expand, ","))
+
+	return fmt.Sprintf(`"%d-%d-%x"`, id, version, h.Sum64())
+}
+
+// projectMovies returns the representations of movies restricted to the
+// selected fields, with the expanded resources inlined
+func (app *application) projectMovies(movies []*data.Movie, p data.Projection) ([]any, error) {
+	projected := make([]any, 0, len(movies))
+
+	if len(p.Fields) == 0 && len(p.Expand) == 0 {
+		for _, movie := range movies {
+			projected = append(projected, movie)
+		}
+
+		return projected, nil
+	}
+
+	ids := make([]int64, 0, len(movies))
+
+	for _, movie := range movies {
+		ids = append(ids, movie.ID)
+	}
+
+	related := make(map[string]map[int64]any, len(p.Expand))
+
+	for _, name := range p.Expand {
+		expander, ok := movieExpanders[name]
+
+		if !ok {
+			return nil, fmt.Errorf("no expander for %q", name)
+		}
+
+		resources, err := expander(app, ids)
+
+		if err != nil {
+			return nil, err
+		}
+
+		related[name] = resources
+	}
+
+	for _, movie := range movies {
+		fields, err := project(movie, p)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for name, resources := range related {
+			fields[name], err = json.Marshal(resources[movie.ID])
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		projected = append(projected, fields)
+	}
+
+	return projected, nil
+}
+
+// project returns the JSON object of v with only the fields selected by p
+func project(v any, p data.Projection) (map[string]json.RawMessage, error) {
+	js, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+
+	err = json.Unmarshal(js, &fields)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range fields {
+		if !p.Selected(name) {
+			delete(fields, name)
+		}
+	}
+
+	return fields, nil
+}
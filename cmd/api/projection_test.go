@@ -0,0 +1,109 @@
+package main
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+func TestReadProjection(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name  string
+		query string
+		want  map[string]string
+	}{
+		{name: "none", query: ""},
+		{name: "known fields", query: "fields=id,title,year"},
+		{name: "unknown field", query: "fields=id,budget", want: map[string]string{"fields": "one_of"}},
+		{name: "duplicate field", query: "fields=id,id", want: map[string]string{"fields": "unique"}},
+		{name: "empty field", query: "fields=id,", want: map[string]string{"fields": "one_of"}},
+		{name: "unknown expand", query: "expand=credits", want: map[string]string{"expand": "one_of"}},
+		{name: "both unknown", query: "fields=budget&expand=credits", want: map[string]string{"fields": "one_of", "expand": "one_of"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs, err := url.ParseQuery(tt.query)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v := validator.New()
+			app.readProjection(qs, data.MovieFieldSafeList, data.MovieExpandSafeList, v)
+
+			if len(v.Errors) != len(tt.want) {
+				t.Fatalf("got errors %v; want %v", v.Errors, tt.want)
+			}
+
+			for key, code := range tt.want {
+				if len(v.Errors[key]) == 0 || v.Errors[key][0].Code != code {
+					t.Errorf("got %s errors %v; want a %s error", key, v.Errors[key], code)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectedETag(t *testing.T) {
+	// The full representation keeps the tag If-Match is checked against
+	if got := projectedETag(7, 3, data.Projection{FieldSafeList: data.MovieFieldSafeList}); got != etag(7, 3) {
+		t.Errorf("got %s for no projection; want %s", got, etag(7, 3))
+	}
+
+	titles := projectedETag(7, 3, data.Projection{Fields: []string{"id", "title"}})
+
+	if titles == etag(7, 3) {
+		t.Error("projection has the tag of the full representation")
+	}
+
+	if !strings.HasPrefix(titles, `"7-3-`) {
+		t.Errorf("got %s; want the id and version in the tag", titles)
+	}
+
+	// The order fields are asked for in does not matter
+	if got := projectedETag(7, 3, data.Projection{Fields: []string{"title", "id"}}); got != titles {
+		t.Errorf("got %s for reordered fields; want %s", got, titles)
+	}
+
+	others := []string{
+		projectedETag(7, 4, data.Projection{Fields: []string{"id", "title"}}),
+		projectedETag(7, 3, data.Projection{Fields: []string{"id", "year"}}),
+		projectedETag(7, 3, data.Projection{Fields: []string{"id", "title"}, Expand: []string{"credits"}}),
+		projectedETag(7, 3, data.Projection{Expand: []string{"id", "title"}}),
+	}
+
+	for i, other := range others {
+		if other == titles {
+			t.Errorf("projection %d has the tag %s of another one", i, other)
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	movie := &data.Movie{ID: 7, Title: "Casablanca", Year: 1942, Genres: []string{"drama"}, Version: 3}
+
+	fields, err := project(movie, data.Projection{Fields: []string{"id", "title", "synopsis"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields left out of the JSON by omitempty stay out
+	got := slices.Sorted(maps.Keys(fields))
+
+	if strings.Join(got, ",") != "id,title" {
+		t.Errorf("got fields %v; want id and title", got)
+	}
+
+	if string(fields["title"]) != `"Casablanca"` {
+		t.Errorf("got title %s", fields["title"])
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"greenlight.chetraseng.com/internal/mailer"
+)
+
+// liveConfig returns the config in effect, including the settings reloaded
+// since the server started
+func (app *application) liveConfig() *config {
+	return app.live.Load()
+}
+
+// setMailer swaps the mailer for one sending with the SMTP settings of cfg
+func (app *application) setMailer(cfg config) {
+	m := mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+	app.mailer.Store(&m)
+}
+
+// reloadable reports whether the setting named after its flag is applied by
+// reloadConfig. Anything else needs a restart.
+func reloadable(name string) bool {
+	switch name {
+	case "cors-trusted-origins", "log-level", "smtp-sender":
+		return true
+	case "limiter-store":
+		return false
+	default:
+		return strings.HasPrefix(name, "limiter-")
+	}
+}
+
+// reloadConfig reads the config again, from the same file, environment and
+// command line as on startup, and swaps in the reloadable settings at once.
+// Every changed setting is logged, the ones needing a restart as warnings.
+// A config which fails to load is logged and the current one is kept.
+func (app *application) reloadConfig() {
+	cfg, opts, err := loadConfig(app.args)
+
+	if err != nil {
+		app.logger.Error("config not reloaded", "error", err.Error())
+		return
+	}
+
+	values := configValues(opts.flags, false)
+	changed := 0
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		old, value := fmt.Sprint(app.values[name]), fmt.Sprint(values[name])
+
+		if old == value {
+			continue
+		}
+
+		if slices.Contains(secretFlags, name) {
+			old, value = redact(name, old), redact(name, value)
+		}
+
+		if !reloadable(name) {
+			app.logger.Warn("config change requires a restart", "setting", name, "old", old, "new", value)
+
+			// Warn again on the next reload, it is still not in effect
+			values[name] = app.values[name]
+			continue
+		}
+
+		app.logger.Info("config changed", "setting", name, "old", old, "new", value)
+		changed++
+	}
+
+	live := *app.liveConfig()
+
+	live.cors = cfg.cors
+	live.logLevel = cfg.logLevel
+	live.smtp.sender = cfg.smtp.sender
+
+	store := live.limiter.store
+	live.limiter = cfg.limiter
+	live.limiter.store = store
+
+	app.live.Store(&live)
+	app.checkRouteLimits(&live)
+
+	// Validated by loadConfig
+	level, _ := parseLogLevel(live.logLevel)
+	app.logLevel.Set(level)
+
+	app.setMailer(live)
+
+	app.values = values
+
+	app.logger.Info("config reloaded", "changed", changed)
+}
@@ -1,34 +1,103 @@
 package main
 
 import (
-	"expvar"
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.chetraseng.com/internal/data"
+	"greenlight.chetraseng.com/internal/storage"
 )
 
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
 	// Custom not found and method not allowed
-	router.NotFound = http.HandlerFunc(app.notFoundResponse)
-	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
-
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHanlder))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
-
-	// Metric routes
-	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
-
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	router.NotFound = app.rateLimit(http.HandlerFunc(app.notFoundResponse))
+	router.MethodNotAllowed = app.rateLimit(http.HandlerFunc(app.methodNotAllowedResponse))
+
+	app.routeKeys = make(map[string]bool)
+
+	// handle registers a route, which records its pattern for the access log
+	// and the rate limits of routes
+	handle := func(method, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, app.routePattern(pattern, app.rateLimit(handler).ServeHTTP))
+		app.routeKeys[method+" "+pattern] = true
+	}
+
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	handle(http.MethodGet, "/livez", app.livezHandler)
+	handle(http.MethodGet, "/readyz", app.readyzHandler(false))
+	handle(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
+	handle(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.staticSegment(map[string]http.HandlerFunc{
+		"export":  app.exportMoviesHandler,
+		"suggest": app.suggestMoviesHandler,
+	}, app.showMovieHandler)))
+	handle(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.idempotent(app.createMovieHandler)))
+	handle(http.MethodPost, "/v1/movies/import", app.requirePermission("movies:write", app.importMoviesHandler))
+	handle(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHanlder))
+	handle(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	handle(http.MethodPut, "/v1/movies/:id/poster", app.requirePermission("movies:write", app.uploadMovieImageHandler(data.ImagePoster)))
+	handle(http.MethodPut, "/v1/movies/:id/backdrop", app.requirePermission("movies:write", app.uploadMovieImageHandler(data.ImageBackdrop)))
+	handle(http.MethodPost, "/v1/users", app.idempotent(app.registerHandler))
+	handle(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	handle(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	handle(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	handle(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	// Images kept on the local filesystem are served by the API itself
+	if local, ok := app.storage.(*storage.Local); ok {
+		fileServer := http.FileServer(local.FileSystem())
+
+		handle(http.MethodGet, "/media/*filepath", func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Path = httprouter.ParamsFromContext(r.Context()).ByName("filepath")
+			fileServer.ServeHTTP(w, r)
+		})
+	}
+
+	app.checkRouteLimits(app.liveConfig())
+
+	return app.hsts(app.requestID(app.trace(app.logRequest(app.metrics(app.recoverPanic(app.enableCORS(app.preRateLimit(app.authenticate(router)))))))))
+}
+
+// checkRouteLimits warns about the route limits of cfg which are not keyed by
+// the method and pattern of a registered route, as they never apply
+func (app *application) checkRouteLimits(cfg *config) {
+	for _, route := range slices.Sorted(maps.Keys(cfg.limiter.routes)) {
+		if !app.routeKeys[route] {
+			app.logger.Warn("rate limit of an unknown route", "route", route)
+		}
+	}
+}
+
+// staticSegment dispatches on the value of the :id parameter. httprouter does
+// not allow a static segment such as /v1/movies/export next to the
+// /v1/movies/:id wildcard, so those routes are registered through the wildcard
+// and resolved here. Any other value is handled by next.
+func (app *application) staticSegment(routes map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := routes[params.ByName("id")]; ok {
+			info := app.contextGetRequestInfo(r)
+			info.route = strings.Replace(info.route, ":id", params.ByName("id"), 1)
+
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// routePattern records the pattern of the matched route for the access log.
+// Raw paths would make every movie ID a route of its own.
+func (app *application) routePattern(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.contextGetRequestInfo(r).route = pattern
+		next(w, r)
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,14 +17,84 @@ func (app *application) server() error {
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.config.port),
 		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  app.config.server.idleTimeout,
+		ReadTimeout:  app.config.server.readTimeout,
+		WriteTimeout: app.config.server.writeTimeout,
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
 
+	if app.config.tlsEnabled() {
+		cr, err := newCertReloader(app.config.tls.certFile, app.config.tls.keyFile, app.logger)
+
+		if err != nil {
+			return err
+		}
+
+		srv.TLSConfig, err = app.tlsConfig(cr)
+
+		if err != nil {
+			return err
+		}
+
+		srv.Protocols = app.protocols()
+	}
+
+	// The other listeners are opened first, so a port already in use is
+	// reported before the API starts taking requests
+	var adminSrv, redirectSrv *http.Server
+
+	if app.config.admin.addr != "" {
+		adminSrv = &http.Server{
+			Addr:        app.config.admin.addr,
+			Handler:     app.adminRoutes(),
+			IdleTimeout: time.Minute,
+			ReadTimeout: 5 * time.Second,
+			// CPU profiles and execution traces run for 30 seconds by default
+			WriteTimeout: 2 * time.Minute,
+			ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		}
+
+		err := app.serveBackground(adminSrv, "admin")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if app.config.tls.redirectAddr != "" {
+		redirectSrv = &http.Server{
+			Addr:         app.config.tls.redirectAddr,
+			Handler:      http.HandlerFunc(app.redirectToHTTPS),
+			IdleTimeout:  app.config.server.idleTimeout,
+			ReadTimeout:  app.config.server.readTimeout,
+			WriteTimeout: app.config.server.writeTimeout,
+			ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		}
+
+		err := app.serveBackground(redirectSrv, "redirect")
+
+		if err != nil {
+			return err
+		}
+	}
+
 	shutdownErr := make(chan error)
 
+	// SIGHUP reloads the settings which can be changed without a restart
+	go func() {
+		hup := make(chan os.Signal, 1)
+
+		signal.Notify(hup, syscall.SIGHUP)
+
+		for range hup {
+			app.logger.Info("reloading config", "signal", syscall.SIGHUP.String())
+			app.reloadConfig()
+		}
+	}()
+
+	// Expired idempotency keys are purged for as long as the server runs
+	go app.purgeIdempotencyKeys()
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -33,24 +104,48 @@ func (app *application) server() error {
 
 		app.logger.Info("shutting down server", "signal", s.String())
 
+		// Report not ready first, and keep serving while load balancers
+		// notice and stop sending requests
+		app.readiness.shuttingDown.Store(true)
+
+		if app.config.health.drainDelay > 0 {
+			app.logger.Info("draining", "delay", app.config.health.drainDelay.String())
+			time.Sleep(app.config.health.drainDelay)
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		err := srv.Shutdown(ctx)
+		// Every server is shut down whatever the others return, and the
+		// errors are sent at once when the background tasks are done
+		errs := []error{srv.Shutdown(ctx)}
 
-		if err != nil {
-			shutdownErr <- err
+		if redirectSrv != nil {
+			errs = append(errs, redirectSrv.Shutdown(ctx))
 		}
 
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
 
 		app.wg.Wait()
-		shutdownErr <- nil
+
+		// Probes and metrics stay up until the API is done
+		if adminSrv != nil {
+			errs = append(errs, adminSrv.Shutdown(ctx))
+		}
+
+		shutdownErr <- errors.Join(errs...)
 	}()
 
-	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env)
+	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env, "tls", app.config.tlsEnabled())
 
-	err := srv.ListenAndServe()
+	var err error
+
+	if app.config.tlsEnabled() {
+		// The certificate comes from srv.TLSConfig
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
 
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
@@ -66,3 +161,25 @@ func (app *application) server() error {
 
 	return nil
 }
+
+// serveBackground opens the listener of srv and serves it in a goroutine.
+// Only errors opening the listener are returned, later ones are logged.
+func (app *application) serveBackground(srv *http.Server, name string) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		app.logger.Info("starting "+name+" server", "addr", srv.Addr)
+
+		err := srv.Serve(ln)
+
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.logger.Error(err.Error(), "addr", srv.Addr)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes, at most once per interval and only while handshakes happen
+const certCheckInterval = 10 * time.Second
+
+// tlsEnabled reports whether the API is served over HTTPS
+func (cfg config) tlsEnabled() bool {
+	return cfg.tls.certFile != "" && cfg.tls.keyFile != ""
+}
+
+// scheme returns the scheme the API is served over
+func (cfg config) scheme() string {
+	if cfg.tlsEnabled() {
+		return "https"
+	}
+
+	return "http"
+}
+
+// parseTLSVersion parses the minimum TLS version setting, such as "1.2"
+func parseTLSVersion(name string) (uint16, error) {
+	switch name {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q", name)
+	}
+}
+
+// certReloader serves the certificate of certFile and keyFile, loading it
+// again once either file changes. A certificate which fails to load, such as
+// one whose key has not been written yet, is logged and the previous one is
+// kept until the next check.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+
+	err := cr.load()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// load reads the certificate and its key. The caller must hold cr.mu once the
+// reloader is in use.
+func (cr *certReloader) load() error {
+	modTime, err := cr.latestModTime()
+
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+
+	if err != nil {
+		return err
+	}
+
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.checkedAt = time.Now()
+
+	cr.logger.Info("loaded certificate", "file", cr.certFile, "expires", cert.Leaf.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+// latestModTime returns the time the certificate or its key last changed
+func (cr *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, name := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(name)
+
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first when its
+// files have changed since it was loaded. It is meant for tls.Config.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if time.Since(cr.checkedAt) < certCheckInterval {
+		return cr.cert, nil
+	}
+
+	cr.checkedAt = time.Now()
+
+	modTime, err := cr.latestModTime()
+
+	if err == nil && !modTime.Equal(cr.modTime) {
+		err = cr.load()
+	}
+
+	if err != nil {
+		cr.logger.Error("certificate not reloaded", "file", cr.certFile, "error", err.Error())
+	}
+
+	return cr.cert, nil
+}
+
+// tlsConfig returns the TLS config of the API server, serving the
+// certificate of cr
+func (app *application) tlsConfig(cr *certReloader) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(app.config.tls.minVersion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: cr.GetCertificate,
+	}, nil
+}
+
+// protocols returns the protocols the API server speaks. HTTP/2 is only ever
+// negotiated over TLS.
+func (app *application) protocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(app.config.tls.http2)
+
+	return protocols
+}
+
+// hsts tells browsers to only reach the API over HTTPS from now on. The header
+// is ignored over plain HTTP, so it is only sent on TLS connections.
+func (app *application) hsts(next http.Handler) http.Handler {
+	if !app.config.tlsEnabled() || app.config.tls.hstsMaxAge <= 0 {
+		return next
+	}
+
+	value := "max-age=" + strconv.Itoa(int(app.config.tls.hstsMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS
+// port. Other methods than GET and HEAD get a 308 so they are not turned into
+// GETs by the client.
+func (app *application) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	if r.Host == "" {
+		app.badRequestResponse(w, r, errors.New("missing Host header"))
+		return
+	}
+
+	host := r.Host
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if app.config.port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(app.config.port))
+	} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+		host = "[" + host + "]"
+	}
+
+	status := http.StatusPermanentRedirect
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		status = http.StatusMovedPermanently
+	}
+
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
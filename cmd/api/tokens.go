@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
@@ -33,7 +34,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 
 	if err != nil {
 		switch {
@@ -99,12 +100,12 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("email", "no matching email address found")
+			v.AddError("/email", validator.Invalid("not_found", "no matching email address found"))
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -114,27 +115,27 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 	}
 
 	if !user.Activated {
-		v.AddError("email", "user account must be activated")
+		v.AddError("/email", validator.Invalid("inactive_account", "user account must be activated"))
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 30*time.Minute, data.ScopePasswordReset)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 30*time.Minute, data.ScopePasswordReset)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
+	app.background(r, func(ctx context.Context) {
 		data := map[string]any{
 			"passwordResetToken": token.Plaintext,
 		}
 
-		err := app.mailer.Send(user.Email, "token_password_reset.tmpl.html", data)
+		err := app.sendMail(ctx, user.Email, "token_password_reset.tmpl.html", data)
 
 		if err != nil {
-			app.logger.Error(err.Error())
+			app.requestLogger(ctx).Error(err.Error())
 		}
 	})
 
@@ -164,12 +165,12 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("email", "no matching email address found")
+			v.AddError("/email", validator.Invalid("not_found", "no matching email address found"))
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -178,26 +179,26 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 	}
 
 	if user.Activated {
-		v.AddError("email", "user has already been activated")
+		v.AddError("/email", validator.Invalid("already_activated", "user has already been activated"))
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
+	app.background(r, func(ctx context.Context) {
 		data := map[string]any{
 			"activationToken": token.Plaintext,
 		}
-		err := app.mailer.Send(user.Email, "token_activation.tmpl.html", data)
+		err := app.sendMail(ctx, user.Email, "token_activation.tmpl.html", data)
 
 		if err != nil {
-			app.logger.Error(err.Error())
+			app.requestLogger(ctx).Error(err.Error())
 		}
 	})
 
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/tomasen/realip"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("greenlight.chetraseng.com/cmd/api")
+
+// openTracer installs the tracer provider exporting spans as configured, and
+// the W3C trace context propagator. The returned function flushes the spans
+// left and must be called before exiting. With no exporter, spans are not
+// recorded at all.
+func openTracer(cfg config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		file     *os.File
+		err      error
+	)
+
+	switch cfg.tracing.exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		file, err = os.OpenFile(cfg.tracing.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.tracing.endpoint))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.tracing.exporter)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("greenlight"),
+		semconv.ServiceVersion(version),
+	))
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.tracing.sampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+
+		if file != nil {
+			file.Close()
+		}
+
+		return err
+	}, nil
+}
+
+// trace starts the span of the request, continuing the trace of the client
+// when it sent a traceparent header. The span is named after the route
+// pattern once the router has matched it.
+func (app *application) trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(realip.FromRequest(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				attribute.String("request_id", app.contextGetRequestID(r.Context())),
+			),
+		)
+		defer span.End()
+
+		mw := newMetricsRespondWriter(w)
+
+		next.ServeHTTP(mw, r.WithContext(ctx))
+
+		info := app.contextGetRequestInfo(r)
+
+		if info.route != "" {
+			span.SetName(r.Method + " " + info.route)
+			span.SetAttributes(semconv.HTTPRoute(info.route))
+		}
+
+		if info.userID != 0 {
+			span.SetAttributes(semconv.UserID(fmt.Sprint(info.userID)))
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(mw.statusCode))
+
+		if mw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(mw.statusCode))
+		}
+	})
+}
+
+// startBackgroundSpan starts the root span of a task run by app.background.
+// The task outlives the request, so its span is linked to the request span
+// rather than being a child of it.
+func startBackgroundSpan(ctx context.Context) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "background",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+	)
+}
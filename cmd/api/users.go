@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
@@ -33,6 +34,7 @@ func (app *application) registerHandler(w http.ResponseWriter, r *http.Request)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
@@ -42,12 +44,12 @@ func (app *application) registerHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	err = app.models.Users.Insert(r.Context(), user)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email already exists")
+			v.AddError("/email", validator.Invalid("duplicate_email", "a user with this email already exists"))
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -57,29 +59,29 @@ func (app *application) registerHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Give movie read permission to the new user
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	err = app.models.Permissions.AddForUser(r.Context(), user.ID, "movies:read")
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
+	app.background(r, func(ctx context.Context) {
 		data := map[string]any{
 			"userID":          token.UserID,
 			"activationToken": token.Plaintext,
 		}
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl.html", data)
+		err := app.sendMail(ctx, user.Email, "user_welcome.tmpl.html", data)
 
 		if err != nil {
-			app.logger.Error(err.Error())
+			app.requestLogger(ctx).Error(err.Error())
 		}
 	})
 
@@ -108,12 +110,12 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	user, err := app.models.Users.GetByToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.models.Users.GetByToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
+			v.AddError("/token", validator.Invalid("invalid_token", "invalid or expired activation token"))
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -123,7 +125,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	// Update user status after token is validated
 	user.Activated = true
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 
 	if err != nil {
 		switch {
@@ -136,7 +138,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Delete all tokens for the user
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -171,12 +173,12 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	user, err := app.models.Users.GetByToken(data.ScopePasswordReset, input.TokenPlaintext)
+	user, err := app.models.Users.GetByToken(r.Context(), data.ScopePasswordReset, input.TokenPlaintext)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired password reset token")
+			v.AddError("/token", validator.Invalid("invalid_token", "invalid or expired password reset token"))
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -192,7 +194,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 
 	if err != nil {
 		switch {
@@ -203,7 +205,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		}
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopePasswordReset, user.ID)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// exportFetchSize is the number of rows fetched from the cursor at once
+const exportFetchSize = 500
+
+// Export streams every movie matching mf, ordered by the
+// filters sort, to fn. Rows are read through a server-side cursor inside a
+// read-only repeatable read transaction, so the export is a consistent
+// snapshot even while movies are being changed. Export stops at the first
+// error returned by fn.
+func (m MovieModel) Export(ctx context.Context, mf MovieFilters, filters Filters, fn func(*Movie) error) error {
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Read-only, so rolling back is how the transaction always ends
+	defer tx.Rollback()
+
+	args := []any{}
+
+	stmt := fmt.Sprintf(`
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, original_title, alternate_titles, synopsis, language,
+			year, runtime, genres, poster, backdrop, version
+		FROM movies
+		WHERE %s
+		ORDER BY %s
+	`, mf.where(&args), filters.orderBy())
+
+	declareCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	declareCtx, span := startQuery(declareCtx, "movies.export", stmt)
+
+	result, err := tx.ExecContext(declareCtx, stmt, args...)
+	recordExec(span, result, err)
+	span.End()
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		movies, err := m.fetchExport(ctx, tx)
+
+		if err != nil {
+			return err
+		}
+
+		// Rows are handed over once the fetch is done, so a slow consumer does
+		// not hold the query open
+		for _, movie := range movies {
+			err = fn(movie)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(movies) < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+// fetchExport fetches the next rows from the export cursor
+func (m MovieModel) fetchExport(ctx context.Context, tx *sql.Tx) ([]*Movie, error) {
+	stmt := fmt.Sprintf("FETCH FORWARD %d FROM movies_export", exportFetchSize)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "movies.export_fetch", stmt)
+	defer span.End()
+
+	rows, err := tx.QueryContext(ctx, stmt)
+
+	if err != nil {
+		recordRows(span, 0, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := make([]*Movie, 0, exportFetchSize)
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.OriginalTitle,
+			pq.Array(&movie.AlternateTitles),
+			&movie.Synopsis,
+			&movie.Language,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			nullImage{&movie.Poster},
+			nullImage{&movie.Backdrop},
+			&movie.Version,
+		)
+
+		if err != nil {
+			recordRows(span, len(movies), err)
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	err = rows.Err()
+	recordRows(span, len(movies), err)
+
+	return movies, err
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+// Facet is the number of movies sharing a value, such as a genre or decade
+type Facet struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets holds the facets of a listing by name
+type Facets map[string][]Facet
+
+// FacetSafeList holds the facets which can be requested for movies
+var FacetSafeList = []string{"genres", "decade", "runtime"}
+
+// facetQueries selects, for each facet, its name, the value, the number of
+// movies and a key to order the values by. %s is replaced by the WHERE clause.
+var facetQueries = map[string]string{
+	"genres": `
+		SELECT 'genres', genre, COUNT(*), -COUNT(*)
+		FROM movies, unnest(genres) AS genre
+		WHERE %s
+		GROUP BY genre`,
+	"decade": `
+		SELECT 'decade', (year / 10 * 10)::text || 's', COUNT(*), MIN(year / 10)
+		FROM movies
+		WHERE %s
+		GROUP BY year / 10`,
+	"runtime": `
+		SELECT 'runtime', bucket, COUNT(*), MIN(runtime)
+		FROM (
+			SELECT runtime, CASE
+				WHEN runtime < 90 THEN '0-89'
+				WHEN runtime < 120 THEN '90-119'
+				WHEN runtime < 150 THEN '120-149'
+				ELSE '150+'
+			END AS bucket
+			FROM movies
+			WHERE %s
+		) AS buckets
+		GROUP BY bucket`,
+}
+
+// ValidateFacets validates the requested facet names
+func ValidateFacets(v *validator.Validator, names []string) {
+	for _, name := range names {
+		v.Check(validator.PermittedValue(name, FacetSafeList...), "facets", validator.OneOf(FacetSafeList...))
+	}
+
+	v.Check(validator.Unique(names), "facets", validator.Duplicates())
+}
+
+// GetFacets counts the movies matching mf for every named facet. All facets
+// are computed by a single query, under the same WHERE clause as GetAll.
+func (m MovieModel) GetFacets(ctx context.Context, mf MovieFilters, names []string) (Facets, error) {
+	facets := make(Facets, len(names))
+
+	if len(names) == 0 {
+		return facets, nil
+	}
+
+	args := []any{}
+	where := mf.where(&args)
+	queries := make([]string, 0, len(names))
+
+	for _, name := range names {
+		queries = append(queries, fmt.Sprintf(facetQueries[name], where))
+		facets[name] = []Facet{}
+	}
+
+	stmt := strings.Join(queries, "\nUNION ALL\n") + "\nORDER BY 1, 4, 2"
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "movies.get_facets", stmt)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+
+	if err != nil {
+		recordRows(span, 0, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	read := 0
+
+	for rows.Next() {
+		var (
+			name  string
+			facet Facet
+			order int
+		)
+
+		err := rows.Scan(&name, &facet.Value, &facet.Count, &order)
+
+		if err != nil {
+			recordRows(span, read, err)
+			return nil, err
+		}
+
+		facets[name] = append(facets[name], facet)
+		read++
+	}
+
+	err = rows.Err()
+	recordRows(span, read, err)
+
+	return facets, err
+}
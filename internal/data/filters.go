@@ -1,7 +1,12 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"slices"
+	"strconv"
 	"strings"
 
 	"greenlight.chetraseng.com/internal/validator"
@@ -12,33 +17,99 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+
+	// After and Before hold opaque cursors for keyset pagination. When one of
+	// them is set, Page is ignored and rows are read relative to the cursor.
+	After  string
+	Before string
+
+	// SkipTotal avoids counting every matching record
+	SkipTotal bool
+
+	// Projection selects the fields read for each record
+	Projection
 }
 
 // Metadata holds metadata for pagination such as current page, page size,
-// first page, last page and total records
+// first page, last page and total records. NextCursor and PrevCursor can be
+// passed back as after and before to read the neighbouring pages.
 type Metadata struct {
-	Page         int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	Page         int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the position of a row in a sorted listing: the sort it belongs to,
+// the value of the sort column and the id which breaks ties.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+
+	if err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
 }
 
 // ValidateFilters validate movie filters
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.PageSize > 0, "page_size", "must be greather than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	v.Check(f.Page > 0, "page", validator.Min(1))
+	v.Check(f.Page <= 10_000_000, "page", validator.Max(10_000_000))
+	v.Check(f.PageSize > 0, "page_size", validator.Min(1))
+	v.Check(f.PageSize <= 100, "page_size", validator.Max(100))
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", validator.OneOf(f.SortSafeList...))
+
+	v.Check(f.After == "" || f.Before == "", "after", validator.Invalid("exclusive", "must not be used together with before"))
+
+	for key, value := range map[string]string{"after": f.After, "before": f.Before} {
+		if value == "" {
+			continue
+		}
+
+		v.Check(f.Page == 1, "page", validator.Invalid("exclusive", "must not be used together with a cursor"))
+
+		c, err := decodeCursor(value)
+
+		v.Check(err == nil, key, validator.Format("cursor"))
+		v.Check(err != nil || c.Sort == f.Sort, key, validator.Invalid("cursor_sort_mismatch", "must have been issued for the same sort"))
+	}
 }
 
+// sortColumn returns the column to sort by. The column is taken from the safe
+// list rather than from the request, so no user input reaches the SQL text.
 func (f Filters) sortColumn() string {
-	if slices.Contains(f.SortSafeList, f.Sort) {
-		return strings.TrimPrefix(f.Sort, "-")
+	i := slices.Index(f.SortSafeList, f.Sort)
+
+	if i == -1 {
+		panic("unsafe sort parameter: " + f.Sort)
 	}
 
-	panic("unsafe sort parameter: " + f.Sort)
+	return strings.TrimPrefix(f.SortSafeList[i], "-")
 }
 
 func (f Filters) sortDirection() string {
@@ -57,6 +128,55 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// keyset reports whether rows are read relative to a cursor
+func (f Filters) keyset() bool {
+	return f.After != "" || f.Before != ""
+}
+
+// orderBy returns the ORDER BY clause of the sort, ties are broken by id
+func (f Filters) orderBy() string {
+	return fmt.Sprintf("%s %s, id ASC", f.sortColumn(), f.sortDirection())
+}
+
+// seek returns the condition selecting the rows past the cursor c in the
+// direction of travel, and the ORDER BY clause which reads them nearest first.
+// Reading backwards flips both, so the rows come out in reverse order.
+func (f Filters) seek(c cursor, args *[]any) (string, string) {
+	column, direction := f.sortColumn(), f.sortDirection()
+
+	op, idOp, idDirection := ">", ">", "ASC"
+
+	if direction == "DESC" {
+		op = "<"
+	}
+
+	if f.Before != "" {
+		op, idOp, idDirection = flipOperator(op), "<", "DESC"
+
+		if direction == "ASC" {
+			direction = "DESC"
+		} else {
+			direction = "ASC"
+		}
+	}
+
+	value := placeholder(args, c.Value)
+	id := placeholder(args, c.ID)
+
+	condition := fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND id %[4]s %[5]s))", column, op, value, idOp, id)
+	orderBy := fmt.Sprintf("%s %s, id %s", column, direction, idDirection)
+
+	return condition, orderBy
+}
+
+func flipOperator(op string) string {
+	if op == ">" {
+		return "<"
+	}
+
+	return ">"
+}
+
 // calculateMetadata calculate metadata based on totalRecords, page and pageSize.
 // Returns an empty Metadata struct if totalRecords is 0
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -72,3 +192,9 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// placeholder appends value to args and returns its "$n" placeholder
+func placeholder(args *[]any, value any) string {
+	*args = append(*args, value)
+	return "$" + strconv.Itoa(len(*args))
+}
@@ -0,0 +1,258 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+var testSortSafeList = []string{"id", "title", "year", "-id", "-title", "-year"}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{Sort: "title", Value: "Casablanca", ID: 1},
+		{Sort: "-year", Value: "1942", ID: 9_000_000_000},
+		{Sort: "title", Value: "", ID: 3},
+		{Sort: "title", Value: `quotes " and / slashes, ünicode`, ID: 4},
+	}
+
+	for _, want := range tests {
+		s := encodeCursor(want)
+
+		got, err := decodeCursor(s)
+
+		if err != nil {
+			t.Errorf("decodeCursor(%q): unexpected error: %v", s, err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	valid := encodeCursor(cursor{Sort: "title", Value: "Casablanca", ID: 1})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "not an object", cursor: base64.RawURLEncoding.EncodeToString([]byte(`["title","x",1]`))},
+		{name: "truncated", cursor: valid[:len(valid)-4]},
+		{name: "tampered", cursor: "x" + valid[1:]},
+		{name: "not json", cursor: base64.RawURLEncoding.EncodeToString([]byte("title,Casablanca,1"))},
+		{name: "wrong types", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":"x","i":"1"}`))},
+		{name: "no id", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":"x"}`))},
+		{name: "negative id", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":"x","i":-1}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor)
+
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v; want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	titleCursor := encodeCursor(cursor{Sort: "title", Value: "Casablanca", ID: 1})
+
+	valid := Filters{Page: 1, PageSize: 20, Sort: "title", SortSafeList: testSortSafeList}
+
+	tests := []struct {
+		name    string
+		filters func(f *Filters)
+		want    map[string][]validator.Error
+	}{
+		{
+			name:    "valid",
+			filters: func(f *Filters) {},
+			want:    map[string][]validator.Error{},
+		},
+		{
+			name:    "valid cursor",
+			filters: func(f *Filters) { f.After = titleCursor },
+			want:    map[string][]validator.Error{},
+		},
+		{
+			name: "out of range",
+			filters: func(f *Filters) {
+				f.Page = 0
+				f.PageSize = 101
+				f.Sort = "rating"
+			},
+			want: map[string][]validator.Error{
+				"page":      {validator.Min(1)},
+				"page_size": {validator.Max(100)},
+				"sort":      {validator.OneOf(testSortSafeList...)},
+			},
+		},
+		{
+			name: "too large",
+			filters: func(f *Filters) {
+				f.Page = 10_000_001
+				f.PageSize = 0
+			},
+			want: map[string][]validator.Error{
+				"page":      {validator.Max(10_000_000)},
+				"page_size": {validator.Min(1)},
+			},
+		},
+		{
+			name: "both cursors",
+			filters: func(f *Filters) {
+				f.After = titleCursor
+				f.Before = titleCursor
+			},
+			want: map[string][]validator.Error{
+				"after": {validator.Invalid("exclusive", "must not be used together with before")},
+			},
+		},
+		{
+			name: "cursor with page",
+			filters: func(f *Filters) {
+				f.Page = 2
+				f.Before = titleCursor
+			},
+			want: map[string][]validator.Error{
+				"page": {validator.Invalid("exclusive", "must not be used together with a cursor")},
+			},
+		},
+		{
+			name:    "invalid cursor",
+			filters: func(f *Filters) { f.Before = "not a cursor!" },
+			want:    map[string][]validator.Error{"before": {validator.Format("cursor")}},
+		},
+		{
+			name:    "cursor of another sort",
+			filters: func(f *Filters) { f.Sort = "-title"; f.After = titleCursor },
+			want: map[string][]validator.Error{
+				"after": {validator.Invalid("cursor_sort_mismatch", "must have been issued for the same sort")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := valid
+			tt.filters(&f)
+
+			v := validator.New()
+			ValidateFilters(v, f)
+
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("got errors %v; want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeek(t *testing.T) {
+	c := cursor{Sort: "title", Value: "Casablanca", ID: 7}
+
+	tests := []struct {
+		name      string
+		sort      string
+		before    bool
+		condition string
+		orderBy   string
+	}{
+		{
+			name:      "ascending, next page",
+			sort:      "title",
+			condition: "(title > $2 OR (title = $2 AND id > $3))",
+			orderBy:   "title ASC, id ASC",
+		},
+		{
+			name:      "descending, next page",
+			sort:      "-title",
+			condition: "(title < $2 OR (title = $2 AND id > $3))",
+			orderBy:   "title DESC, id ASC",
+		},
+		{
+			name:      "ascending, previous page",
+			sort:      "title",
+			before:    true,
+			condition: "(title < $2 OR (title = $2 AND id < $3))",
+			orderBy:   "title DESC, id DESC",
+		},
+		{
+			name:      "descending, previous page",
+			sort:      "-title",
+			before:    true,
+			condition: "(title > $2 OR (title = $2 AND id < $3))",
+			orderBy:   "title ASC, id DESC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Sort: tt.sort, SortSafeList: testSortSafeList}
+
+			if tt.before {
+				f.Before = encodeCursor(c)
+			} else {
+				f.After = encodeCursor(c)
+			}
+
+			// Placeholders carry on from the arguments of the other conditions
+			args := []any{"drama"}
+
+			condition, orderBy := f.seek(c, &args)
+
+			if condition != tt.condition {
+				t.Errorf("got condition %q; want %q", condition, tt.condition)
+			}
+
+			if orderBy != tt.orderBy {
+				t.Errorf("got ORDER BY %q; want %q", orderBy, tt.orderBy)
+			}
+
+			if want := []any{"drama", "Casablanca", int64(7)}; !reflect.DeepEqual(args, want) {
+				t.Errorf("got args %v; want %v", args, want)
+			}
+		})
+	}
+}
+
+func TestSortColumn(t *testing.T) {
+	f := Filters{Sort: "-year", SortSafeList: testSortSafeList}
+
+	if got := f.orderBy(); got != "year DESC, id ASC" {
+		t.Errorf("got ORDER BY %q", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("unsafe sort did not panic")
+		}
+	}()
+
+	Filters{Sort: "year; DROP TABLE movies", SortSafeList: testSortSafeList}.sortColumn()
+}
+
+func TestCalculateMetadata(t *testing.T) {
+	tests := []struct {
+		total, page, pageSize int
+		want                  Metadata
+	}{
+		{total: 0, page: 1, pageSize: 20, want: Metadata{}},
+		{total: 20, page: 1, pageSize: 20, want: Metadata{Page: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 20}},
+		{total: 21, page: 2, pageSize: 20, want: Metadata{Page: 2, PageSize: 20, FirstPage: 1, LastPage: 2, TotalRecords: 21}},
+	}
+
+	for _, tt := range tests {
+		if got := calculateMetadata(tt.total, tt.page, tt.pageSize); got != tt.want {
+			t.Errorf("calculateMetadata(%d, %d, %d) = %+v; want %+v", tt.total, tt.page, tt.pageSize, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyKey is a request made with an Idempotency-Key header, along with
+// the response it got. Keys are scoped to a user and a route. A zero Status
+// means the request is still being handled.
+type IdempotencyKey struct {
+	Scope       string
+	Route       string
+	Key         string
+	Fingerprint []byte
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+}
+
+type IdempotencyKeyModel struct {
+	DB *sql.DB
+}
+
+// Begin claims the key for a new request, for ttl. A key whose previous
+// request has expired is claimed again. When the key is held by a live
+// request, that request is returned instead and nothing is claimed.
+func (m IdempotencyKeyModel) Begin(ctx context.Context, key *IdempotencyKey, ttl time.Duration) (*IdempotencyKey, error) {
+	stmt := `
+		INSERT INTO idempotency_keys (scope, route, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5))
+		ON CONFLICT (scope, route, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = 0, header = '{}', body = '',
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING key
+	`
+
+	args := []any{key.Scope, key.Route, key.Key, key.Fingerprint, ttl.Seconds()}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "idempotency_keys.begin", stmt)
+	defer span.End()
+
+	var claimed string
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&claimed)
+	recordRow(span, err)
+
+	if err == nil {
+		return nil, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	stmt = `
+		SELECT fingerprint, status, header, body
+		FROM idempotency_keys
+		WHERE scope = $1 AND route = $2 AND key = $3
+	`
+
+	existing := IdempotencyKey{Scope: key.Scope, Route: key.Route, Key: key.Key}
+
+	var header []byte
+
+	err = m.DB.QueryRowContext(ctx, stmt, key.Scope, key.Route, key.Key).Scan(
+		&existing.Fingerprint,
+		&existing.Status,
+		&header,
+		&existing.Body,
+	)
+	recordRow(span, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(header, &existing.Header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &existing, nil
+}
+
+// Complete stores the response to the request holding the key
+func (m IdempotencyKeyModel) Complete(ctx context.Context, key *IdempotencyKey) error {
+	header, err := json.Marshal(key.Header)
+
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		UPDATE idempotency_keys
+		SET status = $1, header = $2, body = $3
+		WHERE scope = $4 AND route = $5 AND key = $6
+	`
+
+	args := []any{key.Status, header, key.Body, key.Scope, key.Route, key.Key}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "idempotency_keys.complete", stmt)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, stmt, args...)
+	recordExec(span, result, err)
+
+	return err
+}
+
+// Release deletes the key, so the request can be retried with it
+func (m IdempotencyKeyModel) Release(ctx context.Context, key *IdempotencyKey) error {
+	stmt := `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND route = $2 AND key = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "idempotency_keys.release", stmt)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, stmt, key.Scope, key.Route, key.Key)
+	recordExec(span, result, err)
+
+	return err
+}
+
+// DeleteExpired deletes every expired key
+func (m IdempotencyKeyModel) DeleteExpired(ctx context.Context) error {
+	stmt := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at <= NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "idempotency_keys.delete_expired", stmt)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, stmt)
+	recordExec(span, result, err)
+
+	return err
+}
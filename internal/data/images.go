@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+// Image is an uploaded movie image and its thumbnails. Keys holds the storage
+// key of every size by name, URLs where each of them is served from. Only
+// the URLs are part of the JSON representation of a movie.
+type Image struct {
+	Keys map[string]string `json:"keys"`
+	URLs map[string]string `json:"urls"`
+}
+
+func (img *Image) MarshalJSON() ([]byte, error) {
+	return json.Marshal(img.URLs)
+}
+
+// Value stores the image, keys included, in a jsonb column
+func (img *Image) Value() (driver.Value, error) {
+	if img == nil {
+		return nil, nil
+	}
+
+	// Use a distinct type, so the keys are not dropped by MarshalJSON
+	type stored Image
+	return json.Marshal((*stored)(img))
+}
+
+// nullImage scans a nullable jsonb image column into an *Image
+type nullImage struct {
+	image **Image
+}
+
+func (n nullImage) Scan(src any) error {
+	if src == nil {
+		*n.image = nil
+		return nil
+	}
+
+	b, ok := src.([]byte)
+
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	type stored Image
+	var img stored
+
+	err := json.Unmarshal(b, &img)
+
+	if err != nil {
+		return err
+	}
+
+	*n.image = (*Image)(&img)
+	return nil
+}
+
+// SetImage replaces the poster or backdrop, as named by kind, of the movie
+// with the given id and returns the image it replaced, if any. The version of
+// the movie is bumped, as its representation changes.
+func (m MovieModel) SetImage(ctx context.Context, id int64, kind string, img *Image) (*Image, error) {
+	var column string
+
+	switch kind {
+	case ImagePoster:
+		column = "poster"
+	case ImageBackdrop:
+		column = "backdrop"
+	default:
+		return nil, fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	// The old value is read from the locked row in the same statement
+	stmt := fmt.Sprintf(`
+		UPDATE movies
+		SET %[1]s = $1, version = version + 1
+		FROM (SELECT id, %[1]s AS previous FROM movies WHERE id = $2 FOR UPDATE) AS old
+		WHERE movies.id = old.id
+		RETURNING old.previous
+	`, column)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "movies.set_image", stmt)
+	defer span.End()
+
+	var previous *Image
+
+	err := m.DB.QueryRowContext(ctx, stmt, img, id).Scan(nullImage{&previous})
+	recordRow(span, err)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return previous, nil
+}
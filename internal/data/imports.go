@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// importBatchSize is the number of rows sent in a single multi-row INSERT.
+const importBatchSize = 500
+
+// MovieImporter inserts movies in batches using multi-row INSERT statements.
+// An atomic importer runs every batch inside one transaction, so nothing is
+// stored until Commit is called. Otherwise each batch is committed on its own.
+type MovieImporter struct {
+	ctx      context.Context
+	db       *sql.DB
+	tx       *sql.Tx
+	batch    []*Movie
+	Inserted int
+}
+
+// NewImporter returns a MovieImporter. When atomic is true a transaction is
+// started and must be finished with either Commit or Rollback. Every batch is
+// inserted under ctx.
+func (m MovieModel) NewImporter(ctx context.Context, atomic bool) (*MovieImporter, error) {
+	importer := &MovieImporter{
+		ctx:   ctx,
+		db:    m.DB,
+		batch: make([]*Movie, 0, importBatchSize),
+	}
+
+	if atomic {
+		tx, err := m.DB.BeginTx(ctx, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		importer.tx = tx
+	}
+
+	return importer, nil
+}
+
+// Add queues the movie and flushes the batch once it is full.
+func (i *MovieImporter) Add(movie *Movie) error {
+	movie.normalize()
+	i.batch = append(i.batch, movie)
+
+	if len(i.batch) >= importBatchSize {
+		return i.Flush()
+	}
+
+	return nil
+}
+
+// Flush inserts every queued movie with a single statement.
+func (i *MovieImporter) Flush() error {
+	if len(i.batch) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(i.batch))
+	args := make([]any, 0, len(i.batch)*8)
+
+	for _, movie := range i.batch {
+		row := make([]string, 0, 8)
+
+		for _, arg := range []any{
+			movie.Title,
+			movie.OriginalTitle,
+			pq.Array(movie.AlternateTitles),
+			movie.Synopsis,
+			movie.Language,
+			movie.Year,
+			movie.Runtime,
+			pq.Array(movie.Genres),
+		} {
+			row = append(row, placeholder(&args, arg))
+		}
+
+		values = append(values, "("+strings.Join(row, ", ")+")")
+	}
+
+	stmt := `
+		INSERT INTO movies (title, original_title, alternate_titles, synopsis, language, year, runtime, genres)
+		VALUES ` + strings.Join(values, ", ")
+
+	ctx, cancel := context.WithTimeout(i.ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "movies.import", stmt)
+	defer span.End()
+
+	var (
+		result sql.Result
+		err    error
+	)
+
+	if i.tx != nil {
+		result, err = i.tx.ExecContext(ctx, stmt, args...)
+	} else {
+		result, err = i.db.ExecContext(ctx, stmt, args...)
+	}
+
+	recordExec(span, result, err)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	i.Inserted += int(rowsAffected)
+	i.batch = i.batch[:0]
+
+	return nil
+}
+
+// Commit flushes the remaining movies and commits the transaction, if any.
+func (i *MovieImporter) Commit() error {
+	err := i.Flush()
+
+	if err != nil {
+		return err
+	}
+
+	if i.tx != nil {
+		return i.tx.Commit()
+	}
+
+	return nil
+}
+
+// Rollback discards the transaction of an atomic importer. Movies inserted by
+// a non-atomic importer have already been committed and are kept.
+func (i *MovieImporter) Rollback() error {
+	i.batch = i.batch[:0]
+
+	if i.tx != nil {
+		i.Inserted = 0
+		return i.tx.Rollback()
+	}
+
+	return nil
+}
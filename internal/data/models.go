@@ -6,10 +6,12 @@ import (
 )
 
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies          MovieModel
+	Users           UserModel
+	Tokens          TokenModel
+	Permissions     PermissionModel
+	IdempotencyKeys IdempotencyKeyModel
+	Schema          SchemaModel
 }
 
 var (
@@ -19,9 +21,11 @@ var (
 
 func NewModel(db *sql.DB) Models {
 	return Models{
-		Users:       UserModel{DB: db},
-		Movies:      MovieModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Users:           UserModel{DB: db},
+		Movies:          MovieModel{DB: db},
+		Tokens:          TokenModel{DB: db},
+		Permissions:     PermissionModel{DB: db},
+		IdempotencyKeys: IdempotencyKeyModel{DB: db},
+		Schema:          SchemaModel{DB: db},
 	}
 }
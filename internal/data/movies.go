@@ -5,6 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -12,74 +16,255 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres"`
-	Version   int32     `json:"version"`
+	ID              int64     `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	Title           string    `json:"title" validate:"required,max=500"`
+	OriginalTitle   string    `json:"original_title,omitempty" validate:"max=500"`
+	AlternateTitles []string  `json:"alternate_titles,omitempty" validate:"max=20,unique,dive,required,max=500"`
+	Synopsis        string    `json:"synopsis,omitempty" validate:"max=10000"`
+	Language        string    `json:"language" validate:"language"`
+	Year            int32     `json:"year" validate:"required,min=1888,notfuture"`
+	Runtime         Runtime   `json:"runtime,omitempty" validate:"required,runtime"`
+	Genres          []string  `json:"genres" validate:"required,min=1,max=5,unique,dive,required"`
+	Poster          *Image    `json:"poster,omitempty"`
+	Backdrop        *Image    `json:"backdrop,omitempty"`
+	Version         int32     `json:"version"`
+
+	// Relevance of the movie to the title search of a listing, and the
+	// matching fragment of its synopsis or title
+	Relevance float64 `json:"relevance,omitempty"`
+	Highlight string  `json:"highlight,omitempty"`
+}
+
+// LanguageSafeList holds the text search configurations a movie language, and
+// the language of a search, can be written in. "simple" does no stemming.
+var LanguageSafeList = []string{
+	"simple", "danish", "dutch", "english", "finnish", "french", "german", "hungarian",
+	"italian", "norwegian", "portuguese", "romanian", "russian", "spanish", "swedish", "turkish",
 }
 
 type MovieModel struct {
 	DB *sql.DB
 }
 
+func init() {
+	validator.RegisterRule("language", func(value reflect.Value, _ string) (bool, validator.Error) {
+		return validator.PermittedValue(value.String(), LanguageSafeList...), validator.OneOf(LanguageSafeList...)
+	})
+
+	validator.RegisterRule("notfuture", func(value reflect.Value, _ string) (bool, validator.Error) {
+		return value.Int() <= int64(time.Now().Year()), validator.Invalid("future", "must not be in the future")
+	})
+
+	validator.RegisterRule("runtime", func(value reflect.Value, _ string) (bool, validator.Error) {
+		return value.Int() > 0, validator.Invalid("runtime", "must be a positive number of minutes")
+	})
+}
+
+// ValidateMovie checks a movie against the validate tags of its fields
 func ValidateMovie(v *validator.Validator, movie *Movie) {
-	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Struct(movie)
+}
+
+// MovieFilters narrows down the movies of a listing. Zero values are unset.
+// CreatedTo is exclusive, so a whole day is matched up to the start of the
+// next one.
+type MovieFilters struct {
+	Title         string
+	SearchMode    string
+	Language      string
+	Genres        []string
+	GenresMode    string
+	ExcludeGenres []string
+	YearMin       int
+	YearMax       int
+	RuntimeMin    int
+	RuntimeMax    int
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+}
+
+// ValidateMovieFilters validates the movie filters of a listing
+func ValidateMovieFilters(v *validator.Validator, f MovieFilters) {
+	v.Check(validator.PermittedValue(f.SearchMode, "fulltext", "fuzzy"), "search_mode", validator.OneOf("fulltext", "fuzzy"))
+	v.Check(validator.PermittedValue(f.Language, LanguageSafeList...), "search_language", validator.OneOf(LanguageSafeList...))
+	v.Check(validator.PermittedValue(f.GenresMode, "all", "any"), "genres_mode", validator.OneOf("all", "any"))
+	v.Check(len(f.Genres) <= 20, "genres", validator.MaxItems(20))
+	v.Check(len(f.ExcludeGenres) <= 20, "exclude_genres", validator.MaxItems(20))
+
+	v.Check(f.YearMin == 0 || validator.Between(f.YearMin, 1888, 9999), "year_min", validator.Range(1888, 9999))
+	v.Check(f.YearMax == 0 || validator.Between(f.YearMax, 1888, 9999), "year_max", validator.Range(1888, 9999))
+	v.Check(validator.OrderedRange(f.YearMin, f.YearMax), "year_max", validator.Invalid("range_order", "must not be less than year_min"))
+
+	v.Check(validator.Between(f.RuntimeMin, 0, 100_000), "runtime_min", validator.Range(0, 100_000))
+	v.Check(validator.Between(f.RuntimeMax, 0, 100_000), "runtime_max", validator.Range(0, 100_000))
+	v.Check(validator.OrderedRange(f.RuntimeMin, f.RuntimeMax), "runtime_max", validator.Invalid("range_order", "must not be less than runtime_min"))
+
+	v.Check(validator.OrderedTimes(f.CreatedFrom, f.CreatedTo), "created_to", validator.Invalid("range_order", "must not be before created_from"))
+}
+
+// where returns the condition matching the filters. Every value is passed
+// as a placeholder appended to args, only constant SQL ends up in the text.
+func (f MovieFilters) where(args *[]any) string {
+	conditions := []string{}
+
+	if f.Title != "" {
+		if f.SearchMode == "fuzzy" {
+			// Word similarity matches typos and partial words, such as "godfater"
+			conditions = append(conditions, placeholder(args, f.Title)+" <% title")
+		} else {
+			conditions = append(conditions, "search_vector @@ "+f.tsquery(args))
+		}
+	}
+
+	if len(f.Genres) > 0 {
+		operator := "@>"
+
+		if f.GenresMode == "any" {
+			operator = "&&"
+		}
+
+		conditions = append(conditions, fmt.Sprintf("genres %s %s", operator, placeholder(args, pq.Array(f.Genres))))
+	}
+
+	if len(f.ExcludeGenres) > 0 {
+		conditions = append(conditions, fmt.Sprintf("NOT (genres && %s)", placeholder(args, pq.Array(f.ExcludeGenres))))
+	}
+
+	if f.YearMin != 0 {
+		conditions = append(conditions, "year >= "+placeholder(args, f.YearMin))
+	}
+
+	if f.YearMax != 0 {
+		conditions = append(conditions, "year <= "+placeholder(args, f.YearMax))
+	}
+
+	if f.RuntimeMin != 0 {
+		conditions = append(conditions, "runtime >= "+placeholder(args, f.RuntimeMin))
+	}
+
+	if f.RuntimeMax != 0 {
+		conditions = append(conditions, "runtime <= "+placeholder(args, f.RuntimeMax))
+	}
 
-	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must bot be in the future")
+	if !f.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= "+placeholder(args, f.CreatedFrom))
+	}
+
+	if !f.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < "+placeholder(args, f.CreatedTo))
+	}
 
-	v.Check(movie.Runtime != 0, "runtime", "must be provided")
-	v.Check(movie.Runtime > 0, "runtime", "must be positive integer")
+	if len(conditions) == 0 {
+		return "TRUE"
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// relevance returns the expression ranking a movie against the title search
+func (f MovieFilters) relevance(args *[]any) string {
+	switch {
+	case f.Title == "":
+		return "0::real"
+	case f.SearchMode == "fuzzy":
+		return fmt.Sprintf("word_similarity(%s, title)", placeholder(args, f.Title))
+	default:
+		return fmt.Sprintf("ts_rank_cd(search_vector, %s)", f.tsquery(args))
+	}
+}
+
+// highlight returns the expression of the synopsis, or the title for movies
+// without one, with the words matching the full-text search marked up
+func (f MovieFilters) highlight(args *[]any) string {
+	if f.Title == "" || f.SearchMode == "fuzzy" {
+		return "''"
+	}
+
+	return fmt.Sprintf(
+		"ts_headline(language, CASE WHEN synopsis <> '' THEN synopsis ELSE title END, %s, 'MaxFragments=2, MaxWords=20, MinWords=5')",
+		f.tsquery(args),
+	)
+}
 
-	v.Check(movie.Genres != nil, "genres", "must be provided")
-	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+// tsquery returns the full-text query of the title search, parsed with the
+// configuration of the search language
+func (f MovieFilters) tsquery(args *[]any) string {
+	return fmt.Sprintf("websearch_to_tsquery(%s::regconfig, %s)", placeholder(args, f.Language), placeholder(args, f.Title))
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+// normalize fills in the defaults of the optional movie fields
+func (movie *Movie) normalize() {
+	if movie.AlternateTitles == nil {
+		movie.AlternateTitles = []string{}
+	}
+
+	if movie.Language == "" {
+		movie.Language = "simple"
+	}
+}
+
+func (m MovieModel) Insert(ctx context.Context, movie *Movie) error {
+	movie.normalize()
+
 	stmt := `
 		INSERT INTO movies 
-		(title, year, runtime, genres) VALUES ($1, $2, $3, $4)
+		(title, original_title, alternate_titles, synopsis, language, year, runtime, genres)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, version
 	`
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []any{
+		movie.Title,
+		movie.OriginalTitle,
+		pq.Array(movie.AlternateTitles),
+		movie.Synopsis,
+		movie.Language,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, stmt, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	ctx, span := startQuery(ctx, "movies.insert", stmt)
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	recordRow(span, err)
+
+	return err
+}
+
+func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	return m.GetProjected(ctx, id, Projection{})
 }
 
-func (m MovieModel) Get(id int64) (*Movie, error) {
+// GetProjected returns the movie with only the columns holding the fields
+// selected by p read from the database
+func (m MovieModel) GetProjected(ctx context.Context, id int64, p Projection) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	stmt := `
-		SELECT id, created_at, title, year, runtime, genres, version
+	columns := p.columns()
+
+	stmt := fmt.Sprintf(`
+		SELECT %s
     FROM movies
     WHERE id = $1
-	`
+	`, strings.Join(columns, ", "))
+
 	var movie Movie
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	ctx, span := startQuery(ctx, "movies.get", stmt)
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(scanMovie(&movie, columns)...)
+	recordRow(span, err)
 
 	if err != nil {
 
@@ -94,15 +279,22 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+func (m MovieModel) Update(ctx context.Context, movie *Movie) error {
+	movie.normalize()
+
 	stmt := `
     UPDATE movies
-    SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-    WHERE id = $5 AND version = $6
+    SET title = $1, original_title = $2, alternate_titles = $3, synopsis = $4, language = $5,
+			year = $6, runtime = $7, genres = $8, version = version + 1
+    WHERE id = $9 AND version = $10
 		RETURNING version
 	`
 	args := []any{
 		movie.Title,
+		movie.OriginalTitle,
+		pq.Array(movie.AlternateTitles),
+		movie.Synopsis,
+		movie.Language,
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
@@ -110,10 +302,14 @@ func (m MovieModel) Update(movie *Movie) error {
 		movie.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startQuery(ctx, "movies.update", stmt)
+	defer span.End()
+
 	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&movie.Version)
+	recordRow(span, err)
 
 	if err != nil {
 		switch {
@@ -127,7 +323,7 @@ func (m MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-func (m MovieModel) Delete(id int64) error {
+func (m MovieModel) Delete(ctx context.Context, id int64) error {
 	if id < 0 {
 		return ErrRecordNotFound
 	}
@@ -136,10 +332,14 @@ func (m MovieModel) Delete(id int64) error {
 		DELETE FROM movies
 		WHERE id = $1
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startQuery(ctx, "movies.delete", stmt)
+	defer span.End()
+
 	result, err := m.DB.ExecContext(ctx, stmt, id)
+	recordExec(span, result, err)
 
 	if err != nil {
 		return err
@@ -158,29 +358,109 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
-	stmt := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version
-		FROM movies
-		WHERE ((to_tsvector('simple', title) @@ plainto_tsquery('simple', $1)) OR $1 = '')
-			AND (genres @> $2 OR $2 = '{}')
-    ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4
-	`, filters.sortColumn(), filters.sortDirection())
+// DeleteVersion deletes the movie only if it is still at the given version.
+// It returns ErrEditConflict when the movie has changed or is gone.
+func (m MovieModel) DeleteVersion(ctx context.Context, id int64, version int32) error {
+	stmt := `
+		DELETE FROM movies
+		WHERE id = $1 AND version = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "movies.delete_version", stmt)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, version)
+	recordExec(span, result, err)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	if err != nil {
+		return err
+	}
+
+	rowAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// GetAll returns a page of movies matching mf. The page is either read by
+// offset or, when filters carries a cursor, relative to it.
+func (m MovieModel) GetAll(ctx context.Context, mf MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	args := []any{}
+	relevance := mf.relevance(&args)
+	highlight := "''"
+
+	if filters.Selected("highlight") {
+		highlight = mf.highlight(&args)
+	}
+
+	where := mf.where(&args)
+
+	// The sort column is read whether or not it is selected, the cursors
+	// are made of it
+	columns := filters.columns(filters.sortColumn())
+	seek := "TRUE"
+	orderBy := filters.orderBy()
+	total := "COUNT(*) OVER()"
+
+	if filters.SkipTotal || filters.keyset() {
+		total = "0"
+	}
+
+	if filters.keyset() {
+		c, err := decodeCursor(filters.After + filters.Before)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		seek, orderBy = filters.seek(c, &args)
+	}
+
+	// A cursor already points at the first row, an offset is not needed
+	offset := 0
+
+	if !filters.keyset() {
+		offset = filters.offset()
+	}
+
+	// Read one more row than needed to find out whether there is a next page
+	limitArg := placeholder(&args, filters.limit()+1)
+	offsetArg := placeholder(&args, offset)
+
+	// The inner query names the relevance, so it can be sorted and sought by
+	// like any other column. The highlight is costly and evaluated for the
+	// returned page only.
+	stmt := fmt.Sprintf(`
+		SELECT %s, %s, relevance, %s
+		FROM (
+			SELECT *, %s AS relevance
+			FROM movies
+			WHERE %s
+		) AS movies
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s OFFSET %s
+	`, total, strings.Join(columns, ", "), highlight, relevance, where, seek, orderBy, limitArg, offsetArg)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(
-		ctx,
-		stmt,
-		title,
-		pq.Array(genres),
-		filters.limit(),
-		filters.offset(),
-	)
+	ctx, span := startQuery(ctx, "movies.get_all", stmt)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
 
 	if err != nil {
+		recordRows(span, 0, err)
 		return nil, Metadata{}, err
 	}
 
@@ -192,26 +472,172 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	for rows.Next() {
 		var movie Movie
 
-		err := rows.Scan(
-			&totalRecord,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+		dest := append([]any{&totalRecord}, scanMovie(&movie, columns)...)
+		dest = append(dest, &movie.Relevance, &movie.Highlight)
+
+		err := rows.Scan(dest...)
 
 		if err != nil {
+			recordRows(span, len(movies), err)
 			return nil, Metadata{}, err
 		}
 
 		movies = append(movies, &movie)
 	}
 
-	metadata := calculateMetadata(totalRecord, filters.Page, filters.PageSize)
+	err = rows.Err()
+	recordRows(span, len(movies), err)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(movies) > filters.limit()
+
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+
+	// Rows read backwards come out in reverse order
+	if filters.Before != "" {
+		slices.Reverse(movies)
+	}
+
+	if filters.keyset() && !filters.SkipTotal {
+		totalRecord, err = m.count(ctx, mf)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	var metadata Metadata
+
+	switch {
+	case filters.keyset():
+		metadata = Metadata{PageSize: filters.PageSize, TotalRecords: totalRecord}
+	case filters.SkipTotal:
+		metadata = Metadata{Page: filters.Page, PageSize: filters.PageSize, FirstPage: 1}
+	default:
+		metadata = calculateMetadata(totalRecord, filters.Page, filters.PageSize)
+	}
+
+	if len(movies) > 0 {
+		first, last := movies[0], movies[len(movies)-1]
+
+		if filters.Before != "" {
+			metadata.NextCursor = movieCursor(filters, last)
+
+			if hasMore {
+				metadata.PrevCursor = movieCursor(filters, first)
+			}
+		} else {
+			if hasMore {
+				metadata.NextCursor = movieCursor(filters, last)
+			}
+
+			if filters.After != "" || filters.Page > 1 {
+				metadata.PrevCursor = movieCursor(filters, first)
+			}
+		}
+	}
 
 	return movies, metadata, nil
+}
+
+// count returns the number of movies matching mf
+func (m MovieModel) count(ctx context.Context, mf MovieFilters) (int, error) {
+	args := []any{}
+	stmt := `SELECT COUNT(*) FROM movies WHERE ` + mf.where(&args)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "movies.count", stmt)
+	defer span.End()
+
+	total := 0
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&total)
+	recordRow(span, err)
+
+	return total, err
+}
+
+// movieCursor returns the cursor pointing at movie for the sort in filters
+func movieCursor(filters Filters, movie *Movie) string {
+	var value string
+
+	switch filters.sortColumn() {
+	case "title":
+		value = movie.Title
+	case "year":
+		value = strconv.Itoa(int(movie.Year))
+	case "runtime":
+		value = strconv.Itoa(int(movie.Runtime))
+	case "relevance":
+		value = strconv.FormatFloat(movie.Relevance, 'g', -1, 64)
+	default:
+		value = strconv.FormatInt(movie.ID, 10)
+	}
+
+	return encodeCursor(cursor{Sort: filters.Sort, Value: value, ID: movie.ID})
+}
+
+// Suggestion is a movie title completing a partial search
+type Suggestion struct {
+	ID    int64   `json:"id"`
+	Title string  `json:"title"`
+	Year  int32   `json:"year"`
+	Score float64 `json:"score"`
+}
+
+// likeEscaper escapes the LIKE wildcards of user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit titles completing q. Titles starting with q
+// come first, followed by titles ranked by their trigram word similarity, so
+// both prefixes and misspellings find a match.
+func (m MovieModel) Suggest(ctx context.Context, q string, limit int) ([]*Suggestion, error) {
+	stmt := `
+		SELECT id, title, year, word_similarity($1, title) AS score
+		FROM movies
+		WHERE title ILIKE $2 OR $1 <% title
+		ORDER BY title ILIKE $2 DESC, score DESC, title ASC, id ASC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "movies.suggest", stmt)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, q, likeEscaper.Replace(q)+"%", limit)
+
+	if err != nil {
+		recordRows(span, 0, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+
+	for rows.Next() {
+		var suggestion Suggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year, &suggestion.Score)
+
+		if err != nil {
+			recordRows(span, len(suggestions), err)
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	err = rows.Err()
+	recordRows(span, len(suggestions), err)
 
+	return suggestions, err
 }
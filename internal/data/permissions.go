@@ -20,7 +20,7 @@ type PermissionModel struct {
 	DB *sql.DB
 }
 
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
 		SELECT permissions.code
 		FROM permissions
@@ -29,12 +29,16 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
     WHERE users.id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startQuery(ctx, "permissions.get_all_for_user", query)
+	defer span.End()
+
 	rows, err := m.DB.QueryContext(ctx, query, userID)
 
 	if err != nil {
+		recordRows(span, 0, err)
 		return nil, err
 	}
 
@@ -46,24 +50,32 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 		err := rows.Scan(&permission)
 
 		if err != nil {
+			recordRows(span, len(permissions), err)
 			return nil, err
 		}
 
 		permissions = append(permissions, permission)
 	}
 
+	recordRows(span, len(permissions), nil)
+
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
 		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	ctx, span := startQuery(ctx, "permissions.add_for_user", query)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	recordExec(span, result, err)
+
 	return err
 }
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"slices"
+
+	"github.com/lib/pq"
+	"greenlight.chetraseng.com/internal/validator"
+)
+
+// Projection restricts a representation to some of its fields and names the
+// related resources to inline in it. Fields and Expand are checked against
+// the safe lists of the resource, much like Filters.Sort.
+type Projection struct {
+	Fields         []string
+	FieldSafeList  []string
+	Expand         []string
+	ExpandSafeList []string
+}
+
+func ValidateProjection(v *validator.Validator, p Projection) {
+	for _, field := range p.Fields {
+		v.Check(validator.PermittedValue(field, p.FieldSafeList...), "fields", validator.OneOf(p.FieldSafeList...))
+	}
+
+	v.Check(validator.Unique(p.Fields), "fields", validator.Duplicates())
+
+	for _, name := range p.Expand {
+		v.Check(validator.PermittedValue(name, p.ExpandSafeList...), "expand", validator.Invalid("one_of", "invalid expand value"))
+	}
+
+	v.Check(validator.Unique(p.Expand), "expand", validator.Duplicates())
+}
+
+// Selected reports whether field is part of the representation. Without
+// fields every field is.
+func (p Projection) Selected(field string) bool {
+	return len(p.Fields) == 0 || slices.Contains(p.Fields, field)
+}
+
+// Expanded reports whether the related resource name is to be inlined
+func (p Projection) Expanded(name string) bool {
+	return slices.Contains(p.Expand, name)
+}
+
+// MovieFieldSafeList holds the fields of a movie which can be selected.
+// Relevance and highlight are only filled in by searches.
+var MovieFieldSafeList = []string{
+	"id", "created_at", "title", "original_title", "alternate_titles", "synopsis", "language",
+	"year", "runtime", "genres", "poster", "backdrop", "version", "relevance", "highlight",
+}
+
+// MovieExpandSafeList holds the resources related to a movie which can be
+// inlined. Credits and ratings belong here once they exist.
+var MovieExpandSafeList = []string{}
+
+// movieColumns holds the columns of the movies table in the order they are
+// selected, with the field of a movie each is scanned into
+var movieColumns = []struct {
+	name string
+	dest func(movie *Movie) any
+}{
+	{"id", func(movie *Movie) any { return &movie.ID }},
+	{"created_at", func(movie *Movie) any { return &movie.CreatedAt }},
+	{"title", func(movie *Movie) any { return &movie.Title }},
+	{"original_title", func(movie *Movie) any { return &movie.OriginalTitle }},
+	{"alternate_titles", func(movie *Movie) any { return pq.Array(&movie.AlternateTitles) }},
+	{"synopsis", func(movie *Movie) any { return &movie.Synopsis }},
+	{"language", func(movie *Movie) any { return &movie.Language }},
+	{"year", func(movie *Movie) any { return &movie.Year }},
+	{"runtime", func(movie *Movie) any { return &movie.Runtime }},
+	{"genres", func(movie *Movie) any { return pq.Array(&movie.Genres) }},
+	{"poster", func(movie *Movie) any { return nullImage{&movie.Poster} }},
+	{"backdrop", func(movie *Movie) any { return nullImage{&movie.Backdrop} }},
+	{"version", func(movie *Movie) any { return &movie.Version }},
+}
+
+// columns returns the columns of the movies table holding the selected
+// fields. The id and version are always read, as are the required columns.
+func (p Projection) columns(required ...string) []string {
+	columns := []string{}
+
+	for _, column := range movieColumns {
+		if p.Selected(column.name) || column.name == "id" || column.name == "version" || slices.Contains(required, column.name) {
+			columns = append(columns, column.name)
+		}
+	}
+
+	return columns
+}
+
+// scanMovie returns the scan destinations in movie of the given columns
+func scanMovie(movie *Movie, columns []string) []any {
+	dest := make([]any, 0, len(columns))
+
+	for _, column := range movieColumns {
+		if slices.Contains(columns, column.name) {
+			dest = append(dest, column.dest(movie))
+		}
+	}
+
+	return dest
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SchemaVersion is the version of the latest migration the models are
+// written against. It must be bumped along with every new migration.
+const SchemaVersion = 11
+
+type SchemaModel struct {
+	DB *sql.DB
+}
+
+// Version returns the version of the last migration applied to the database
+// and whether it failed half way, as recorded by migrate
+func (m SchemaModel) Version(ctx context.Context) (int, bool, error) {
+	query := `
+		SELECT version, dirty
+		FROM schema_migrations
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "schema.version", query)
+	defer span.End()
+
+	var (
+		version int
+		dirty   bool
+	)
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	recordRow(span, err)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
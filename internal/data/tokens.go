@@ -55,18 +55,18 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 }
 
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
-	v.Check(tokenPlaintext != "", "token", "must be provided")
-	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+	v.Check(tokenPlaintext != "", "/token", validator.Required())
+	v.Check(len(tokenPlaintext) == 26, "/token", validator.Length(26))
 }
 
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
 
 	if err != nil {
 		return nil, err
@@ -75,7 +75,7 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, nil
 }
 
-func (m TokenModel) Insert(token *Token) error {
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
     INSERT INTO tokens (hash, user_id, expiry, scope)
     VALUES ($1, $2, $3, $4)
@@ -87,22 +87,32 @@ func (m TokenModel) Insert(token *Token) error {
 		token.Scope,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	ctx, span := startQuery(ctx, "tokens.insert", query)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	recordExec(span, result, err)
+
 	return err
 }
 
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
 		DELETE FROM tokens
 		WHERE scope = $1 AND user_id = $2
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	ctx, span := startQuery(ctx, "tokens.delete_all_for_user", query)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, scope, userID)
+	recordExec(span, result, err)
+
 	return err
 }
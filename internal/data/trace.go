@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("greenlight.chetraseng.com/internal/data")
+
+// startQuery starts the span of a query under the statement name, such as
+// "movies.get", as a child of the span carried by ctx. The caller ends it.
+func startQuery(ctx context.Context, name, stmt string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBQuerySummary(name),
+			semconv.DBQueryText(stmt),
+		),
+	)
+}
+
+// recordRows records the number of rows a query returned or affected on its
+// span, along with err. A query finding no rows is not an error.
+func recordRows(span trace.Span, rows int, err error) {
+	span.SetAttributes(semconv.DBResponseReturnedRows(rows))
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// recordRow records the result of a query reading a single row
+func recordRow(span trace.Span, err error) {
+	rows := 0
+
+	if err == nil {
+		rows = 1
+	}
+
+	recordRows(span, rows, err)
+}
+
+// recordExec records the result of a statement run with ExecContext
+func recordExec(span trace.Span, result sql.Result, err error) {
+	var rows int64
+
+	if err == nil {
+		rows, _ = result.RowsAffected()
+	}
+
+	recordRows(span, int(rows), err)
+}
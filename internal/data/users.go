@@ -14,8 +14,8 @@ import (
 type User struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
+	Name      string    `json:"name" validate:"required,max=500"`
+	Email     string    `json:"email" validate:"required,email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int32     `json:"version"`
@@ -68,22 +68,19 @@ func (p *password) Matches(plantextPassword string) (bool, error) {
 }
 
 func ValidateEmail(v *validator.Validator, email string) {
-	v.Check(email != "", "email", "must be provided")
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+	v.Check(email != "", "/email", validator.Required())
+	v.Check(validator.Matches(email, validator.EmailRX), "/email", validator.Format("email address"))
 }
 
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 
-	v.Check(password != "", "password", "must be provided")
-	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(password != "", "/password", validator.Required())
+	v.Check(len(password) >= 8, "/password", validator.MinLength(8))
+	v.Check(len(password) <= 72, "/password", validator.MaxLength(72))
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
-	v.Check(user.Name != "", "name", "must be provided")
-	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
-
-	ValidateEmail(v, user.Email)
+	v.Struct(user)
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
@@ -94,18 +91,22 @@ func ValidateUser(v *validator.Validator, user *User) {
 	}
 }
 
-func (m *UserModel) Get(id int64) (*User, error) {
+func (m *UserModel) Get(ctx context.Context, id int64) (*User, error) {
 	query := `
 		SELECT id, created_at, name, email, password_hash, activated, version
     FROM users
     WHERE id = $1
 	`
-	ctx, timeout := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, timeout := context.WithTimeout(ctx, 3*time.Second)
 	defer timeout()
 
+	ctx, span := startQuery(ctx, "users.get", query)
+	defer span.End()
+
 	var user = User{}
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.Version)
+	recordRow(span, err)
 
 	if err != nil {
 		switch {
@@ -119,7 +120,7 @@ func (m *UserModel) Get(id int64) (*User, error) {
 	return &user, nil
 }
 
-func (m *UserModel) Insert(user *User) error {
+func (m *UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
 			INSERT INTO users (name, email, password_hash, activated)
 			VALUEs ($1, $2, $3, $4)
@@ -130,10 +131,14 @@ func (m *UserModel) Insert(user *User) error {
 		user.Name, user.Email, user.Password.hash, user.Activated,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startQuery(ctx, "users.insert", query)
+	defer span.End()
+
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	recordRow(span, err)
 
 	if err != nil {
 		switch {
@@ -147,7 +152,7 @@ func (m *UserModel) Insert(user *User) error {
 	return nil
 }
 
-func (m *UserModel) GetByEmail(email string) (*User, error) {
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 
 	query := `
 			SELECT id, created_at, name, email, password_hash, activated, version
@@ -157,9 +162,12 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startQuery(ctx, "users.get_by_email", query)
+	defer span.End()
+
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.CreatedAt,
@@ -169,6 +177,7 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 		&user.Activated,
 		&user.Version,
 	)
+	recordRow(span, err)
 
 	if err != nil {
 		switch {
@@ -182,7 +191,7 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (m *UserModel) Update(user *User) error {
+func (m *UserModel) Update(ctx context.Context, user *User) error {
 
 	query := `
       UPDATE users
@@ -200,10 +209,14 @@ func (m *UserModel) Update(user *User) error {
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startQuery(ctx, "users.update", query)
+	defer span.End()
+
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	recordRow(span, err)
 
 	if err != nil {
 		switch {
@@ -219,7 +232,7 @@ func (m *UserModel) Update(user *User) error {
 	return nil
 }
 
-func (m *UserModel) GetByToken(scope, token string) (*User, error) {
+func (m *UserModel) GetByToken(ctx context.Context, scope, token string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(token))
 
 	query := `
@@ -240,9 +253,12 @@ func (m *UserModel) GetByToken(scope, token string) (*User, error) {
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startQuery(ctx, "users.get_by_token", query)
+	defer span.End()
+
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&user.ID,
 		&user.CreatedAt,
@@ -250,6 +266,7 @@ func (m *UserModel) GetByToken(scope, token string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated, &user.Version)
+	recordRow(span, err)
 
 	if err != nil {
 		switch {
@@ -0,0 +1,100 @@
+// Package images validates uploaded images and generates their thumbnails
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+
+	// Register the decoders of the accepted formats
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels bounds the size of a decoded image, so a small but highly
+// compressed upload can not exhaust the memory
+const MaxPixels = 50_000_000
+
+var (
+	ErrUnsupportedFormat = errors.New("image must be a JPEG, PNG, GIF or WebP")
+	ErrTooLarge          = fmt.Errorf("image must not have more than %d pixels", MaxPixels)
+)
+
+// ContentTypes holds the accepted content types by image format name
+var ContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+// Decode checks that data holds an image in one of the accepted formats and
+// decodes it. It returns the image and its format name.
+func Decode(data []byte) (image.Image, string, error) {
+	sniffed := http.DetectContentType(data)
+
+	format := ""
+
+	for name, contentType := range ContentTypes {
+		if contentType == sniffed {
+			format = name
+		}
+	}
+
+	if format == "" {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	// Check the dimensions before spending memory on the pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	// An empty image has nothing to show, and no aspect ratio to scale by
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	return img, format, nil
+}
+
+// Thumbnail scales img down to width, keeping its aspect ratio, and encodes
+// it as a JPEG. Images narrower than width keep their size. Transparent
+// areas are flattened onto white, as JPEG has no alpha channel.
+func Thumbnail(img image.Image, width int) ([]byte, error) {
+	bounds := img.Bounds()
+	width = min(width, bounds.Dx())
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	buf := new(bytes.Buffer)
+
+	err := jpeg.Encode(buf, dst, &jpeg.Options{Quality: 85})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,173 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encodePNG returns a width by height PNG filled with c
+func encodePNG(t *testing.T, width, height int, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	err := png.Encode(&buf, img)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// pngHeader returns the start of a PNG claiming to be width by height, which
+// is enough for image.DecodeConfig but holds no pixels
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 2 // truecolor
+
+	chunk := append([]byte("IHDR"), ihdr...)
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	img, format, err := Decode(encodePNG(t, 40, 20, color.NRGBA{R: 255, A: 255}))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if format != "png" {
+		t.Errorf("got format %q; want %q", format, "png")
+	}
+
+	if got := img.Bounds().Size(); got != image.Pt(40, 20) {
+		t.Errorf("got size %v; want %v", got, image.Pt(40, 20))
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var emptyGIF bytes.Buffer
+
+	err := gif.Encode(&emptyGIF, image.NewPaletted(image.Rect(0, 0, 0, 0), color.Palette{color.Black}), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "not an image", data: []byte("hello, world"), want: ErrUnsupportedFormat},
+		{name: "empty", data: nil, want: ErrUnsupportedFormat},
+		{name: "svg", data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), want: ErrUnsupportedFormat},
+		{name: "truncated png", data: pngHeader(10, 10), want: ErrUnsupportedFormat},
+		{name: "no pixels", data: emptyGIF.Bytes(), want: ErrUnsupportedFormat},
+		{name: "too many pixels", data: pngHeader(10_000, 10_000), want: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Decode(tt.data)
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		scale  int
+		want   image.Point
+	}{
+		{name: "scaled down", width: 40, height: 20, scale: 10, want: image.Pt(10, 5)},
+		{name: "narrower than width", width: 8, height: 4, scale: 100, want: image.Pt(8, 4)},
+		{name: "thin strip keeps a row", width: 100, height: 1, scale: 10, want: image.Pt(10, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, _, err := Decode(encodePNG(t, tt.width, tt.height, color.NRGBA{R: 255, A: 255}))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := Thumbnail(img, tt.scale)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			thumb, err := jpeg.Decode(bytes.NewReader(data))
+
+			if err != nil {
+				t.Fatalf("thumbnail is not a JPEG: %v", err)
+			}
+
+			if got := thumb.Bounds().Size(); got != tt.want {
+				t.Errorf("got size %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnailFlattensTransparency(t *testing.T) {
+	img, _, err := Decode(encodePNG(t, 16, 16, color.NRGBA{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Thumbnail(img, 16)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// JPEG is lossy, so white is anything close enough to it
+	r, g, b, _ := thumb.At(8, 8).RGBA()
+
+	if r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("got transparent area flattened to %d,%d,%d; want white", r>>8, g>>8, b>>8)
+	}
+}
@@ -0,0 +1,423 @@
+// Package jsonpatch applies RFC 7396 JSON Merge Patch and RFC 6902 JSON Patch
+// documents to JSON values
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch     = errors.New("invalid patch document")
+	ErrInvalidOperation = errors.New("invalid operation")
+	ErrInvalidPointer   = errors.New("invalid JSON pointer")
+	ErrPathNotFound     = errors.New("path does not exist")
+	ErrTestFailed       = errors.New("test failed")
+)
+
+// Operation is a single operation of a JSON Patch document
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// OperationError reports the operation of a JSON Patch which failed, by its
+// index in the patch document
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// Pointer returns the JSON pointer of the failing operation in the patch
+// document
+func (e *OperationError) Pointer() string {
+	return "/" + strconv.Itoa(e.Index)
+}
+
+// MergePatch applies the merge patch to doc. Members of the patch set to null
+// are removed from the document, objects are merged recursively and any other
+// value replaces the one in the document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+
+	err := json.Unmarshal(doc, &target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(patch, &p)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+
+	if !ok {
+		t = map[string]any{}
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+
+	return t
+}
+
+// Apply applies the operations of the JSON Patch to doc, in order. The patch
+// is atomic: the first failing operation is reported as an *OperationError
+// and doc is left as it was.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target any
+
+	err := json.Unmarshal(doc, &target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+
+	err = json.Unmarshal(patch, &ops)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range ops {
+		target, err = apply(target, op)
+
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func apply(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidOperation)
+		}
+
+		var value any
+
+		err := json.Unmarshal(op.Value, &value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidOperation, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			doc, _, err = remove(doc, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+
+			return doc, nil
+		}
+
+	case "remove":
+		if len(path) == 0 {
+			return nil, fmt.Errorf("%w: the whole document can not be removed", ErrInvalidOperation)
+		}
+
+		doc, _, err = remove(doc, path)
+		return doc, err
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			return add(doc, path, deepCopy(value))
+		}
+
+		if op.From == op.Path {
+			return doc, nil
+		}
+
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("%w: a value can not be moved into one of its children", ErrInvalidOperation)
+		}
+
+		doc, _, err = remove(doc, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return add(doc, path, value)
+
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidOperation, op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q must start with /", ErrInvalidPointer, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// index parses the token addressing an element of an array of length n. With
+// insert the index may point just past the end, which "-" always does.
+func index(token string, n int, insert bool) (int, error) {
+	if insert && token == "-" {
+		return n, nil
+	}
+
+	i, err := strconv.Atoi(token)
+
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrInvalidPointer, token)
+	}
+
+	if i > n || (i == n && !insert) {
+		return 0, ErrPathNotFound
+	}
+
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+
+			doc = value
+		case []any:
+			i, err := index(token, len(node), false)
+
+			if err != nil {
+				return nil, err
+			}
+
+			doc = node[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+
+	return doc, nil
+}
+
+// add returns doc with value added at path. Arrays may be reallocated, so the
+// returned value must replace doc.
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token := path[0]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			node[token] = value
+			return node, nil
+		}
+
+		child, ok := node[token]
+
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+
+		child, err := add(child, path[1:], value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		node[token] = child
+		return node, nil
+
+	case []any:
+		i, err := index(token, len(node), len(path) == 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(path) == 1 {
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+
+		child, err := add(node[i], path[1:], value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		node[i] = child
+		return node, nil
+
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// remove returns doc without the value at path, along with the removed value
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	token := path[0]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+
+		if !ok {
+			return nil, nil, ErrPathNotFound
+		}
+
+		if len(path) == 1 {
+			delete(node, token)
+			return node, child, nil
+		}
+
+		child, removed, err := remove(child, path[1:])
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		node[token] = child
+		return node, removed, nil
+
+	case []any:
+		i, err := index(token, len(node), false)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(path) == 1 {
+			removed := node[i]
+			return append(node[:i], node[i+1:]...), removed, nil
+		}
+
+		child, removed, err := remove(node[i], path[1:])
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		node[i] = child
+		return node, removed, nil
+
+	default:
+		return nil, nil, ErrPathNotFound
+	}
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+
+		for key, child := range v {
+			c[key] = deepCopy(child)
+		}
+
+		return c
+	case []any:
+		c := make([]any, len(v))
+
+		for i, child := range v {
+			c[i] = deepCopy(child)
+		}
+
+		return c
+	default:
+		return value
+	}
+}
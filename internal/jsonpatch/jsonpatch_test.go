@@ -0,0 +1,418 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// assertJSON fails the test unless got and want hold the same JSON value
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w any
+
+	err := json.Unmarshal(got, &g)
+
+	if err != nil {
+		t.Fatalf("got invalid JSON %s: %v", got, err)
+	}
+
+	err = json.Unmarshal([]byte(want), &w)
+
+	if err != nil {
+		t.Fatalf("want invalid JSON %s: %v", want, err)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "add member",
+			doc:   `{"title":"Moana"}`,
+			patch: `[{"op":"add","path":"/year","value":2016}]`,
+			want:  `{"title":"Moana","year":2016}`,
+		},
+		{
+			name:  "add replaces existing member",
+			doc:   `{"year":2015}`,
+			patch: `[{"op":"add","path":"/year","value":2016}]`,
+			want:  `{"year":2016}`,
+		},
+		{
+			name:  "add inserts into array",
+			doc:   `{"genres":["animation","family"]}`,
+			patch: `[{"op":"add","path":"/genres/1","value":"adventure"}]`,
+			want:  `{"genres":["animation","adventure","family"]}`,
+		},
+		{
+			name:  "add at array end",
+			doc:   `{"genres":["animation"]}`,
+			patch: `[{"op":"add","path":"/genres/1","value":"family"}]`,
+			want:  `{"genres":["animation","family"]}`,
+		},
+		{
+			name:  "add appends with dash",
+			doc:   `{"genres":["animation"]}`,
+			patch: `[{"op":"add","path":"/genres/-","value":"family"}]`,
+			want:  `{"genres":["animation","family"]}`,
+		},
+		{
+			name:  "add null value",
+			doc:   `{}`,
+			patch: `[{"op":"add","path":"/synopsis","value":null}]`,
+			want:  `{"synopsis":null}`,
+		},
+		{
+			name:  "add replaces whole document",
+			doc:   `{"title":"Moana"}`,
+			patch: `[{"op":"add","path":"","value":{"title":"Cars"}}]`,
+			want:  `{"title":"Cars"}`,
+		},
+		{
+			name:  "remove member",
+			doc:   `{"title":"Moana","year":2016}`,
+			patch: `[{"op":"remove","path":"/year"}]`,
+			want:  `{"title":"Moana"}`,
+		},
+		{
+			name:  "remove array element",
+			doc:   `{"genres":["animation","adventure","family"]}`,
+			patch: `[{"op":"remove","path":"/genres/1"}]`,
+			want:  `{"genres":["animation","family"]}`,
+		},
+		{
+			name:  "replace member",
+			doc:   `{"title":"Moana","year":2015}`,
+			patch: `[{"op":"replace","path":"/year","value":2016}]`,
+			want:  `{"title":"Moana","year":2016}`,
+		},
+		{
+			name:  "replace array element",
+			doc:   `{"genres":["animation","drama"]}`,
+			patch: `[{"op":"replace","path":"/genres/1","value":"family"}]`,
+			want:  `{"genres":["animation","family"]}`,
+		},
+		{
+			name:  "move member",
+			doc:   `{"title":"Moana","meta":{}}`,
+			patch: `[{"op":"move","from":"/title","path":"/meta/title"}]`,
+			want:  `{"meta":{"title":"Moana"}}`,
+		},
+		{
+			name:  "move array element",
+			doc:   `{"genres":["a","b","c"]}`,
+			patch: `[{"op":"move","from":"/genres/0","path":"/genres/-"}]`,
+			want:  `{"genres":["b","c","a"]}`,
+		},
+		{
+			name:  "move onto itself",
+			doc:   `{"title":"Moana"}`,
+			patch: `[{"op":"move","from":"/title","path":"/title"}]`,
+			want:  `{"title":"Moana"}`,
+		},
+		{
+			name:  "copy member",
+			doc:   `{"title":"Moana"}`,
+			patch: `[{"op":"copy","from":"/title","path":"/original_title"}]`,
+			want:  `{"title":"Moana","original_title":"Moana"}`,
+		},
+		{
+			name:  "copy is deep",
+			doc:   `{"a":{"genres":["animation"]}}`,
+			patch: `[{"op":"copy","from":"/a","path":"/b"},{"op":"add","path":"/b/genres/-","value":"family"}]`,
+			want:  `{"a":{"genres":["animation"]},"b":{"genres":["animation","family"]}}`,
+		},
+		{
+			name:  "test passes",
+			doc:   `{"title":"Moana","genres":["animation"]}`,
+			patch: `[{"op":"test","path":"/genres","value":["animation"]},{"op":"replace","path":"/title","value":"Cars"}]`,
+			want:  `{"title":"Cars","genres":["animation"]}`,
+		},
+		{
+			name:  "tilde one escapes slash",
+			doc:   `{"a/b":1}`,
+			patch: `[{"op":"replace","path":"/a~1b","value":2}]`,
+			want:  `{"a/b":2}`,
+		},
+		{
+			name:  "tilde zero escapes tilde",
+			doc:   `{"a~b":1}`,
+			patch: `[{"op":"remove","path":"/a~0b"}]`,
+			want:  `{}`,
+		},
+		{
+			name:  "tilde zero one is not a slash",
+			doc:   `{"~1":1}`,
+			patch: `[{"op":"replace","path":"/~01","value":2}]`,
+			want:  `{"~1":2}`,
+		},
+		{
+			name:  "empty key",
+			doc:   `{"":1}`,
+			patch: `[{"op":"replace","path":"/","value":2}]`,
+			want:  `{"":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		index int
+		want  error
+	}{
+		{
+			name:  "test fails",
+			doc:   `{"year":2016}`,
+			patch: `[{"op":"test","path":"/year","value":2015}]`,
+			want:  ErrTestFailed,
+		},
+		{
+			name:  "test compares types",
+			doc:   `{"year":2016}`,
+			patch: `[{"op":"test","path":"/year","value":"2016"}]`,
+			want:  ErrTestFailed,
+		},
+		{
+			name:  "leading zero index",
+			doc:   `{"genres":["a","b"]}`,
+			patch: `[{"op":"replace","path":"/genres/01","value":"c"}]`,
+			want:  ErrInvalidPointer,
+		},
+		{
+			name:  "negative index",
+			doc:   `{"genres":["a","b"]}`,
+			patch: `[{"op":"remove","path":"/genres/-1"}]`,
+			want:  ErrInvalidPointer,
+		},
+		{
+			name:  "dash outside add",
+			doc:   `{"genres":["a"]}`,
+			patch: `[{"op":"remove","path":"/genres/-"}]`,
+			want:  ErrInvalidPointer,
+		},
+		{
+			name:  "index past end",
+			doc:   `{"genres":["a"]}`,
+			patch: `[{"op":"add","path":"/genres/2","value":"b"}]`,
+			want:  ErrPathNotFound,
+		},
+		{
+			name:  "replace missing member",
+			doc:   `{}`,
+			patch: `[{"op":"replace","path":"/title","value":"Moana"}]`,
+			want:  ErrPathNotFound,
+		},
+		{
+			name:  "add under missing parent",
+			doc:   `{}`,
+			patch: `[{"op":"add","path":"/meta/title","value":"Moana"}]`,
+			want:  ErrPathNotFound,
+		},
+		{
+			name:  "remove missing member",
+			doc:   `{}`,
+			patch: `[{"op":"remove","path":"/title"}]`,
+			want:  ErrPathNotFound,
+		},
+		{
+			name:  "remove whole document",
+			doc:   `{}`,
+			patch: `[{"op":"remove","path":""}]`,
+			want:  ErrInvalidOperation,
+		},
+		{
+			name:  "move into child",
+			doc:   `{"a":{"b":{}}}`,
+			patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			want:  ErrInvalidOperation,
+		},
+		{
+			name:  "missing value",
+			doc:   `{}`,
+			patch: `[{"op":"add","path":"/title"}]`,
+			want:  ErrInvalidOperation,
+		},
+		{
+			name:  "unknown op",
+			doc:   `{}`,
+			patch: `[{"op":"increment","path":"/year"}]`,
+			want:  ErrInvalidOperation,
+		},
+		{
+			name:  "pointer without slash",
+			doc:   `{"title":"Moana"}`,
+			patch: `[{"op":"remove","path":"title"}]`,
+			want:  ErrInvalidPointer,
+		},
+		{
+			name:  "index of failing operation",
+			doc:   `{"title":"Moana"}`,
+			patch: `[{"op":"replace","path":"/title","value":"Cars"},{"op":"remove","path":"/year"}]`,
+			index: 1,
+			want:  ErrPathNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply([]byte(tt.doc), []byte(tt.patch))
+
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v; want %v", err, tt.want)
+			}
+
+			var opErr *OperationError
+
+			if !errors.As(err, &opErr) {
+				t.Fatalf("got error %T; want *OperationError", err)
+			}
+
+			if opErr.Index != tt.index {
+				t.Errorf("got index %d; want %d", opErr.Index, tt.index)
+			}
+		})
+	}
+}
+
+func TestApplyInvalidPatch(t *testing.T) {
+	for _, patch := range []string{`{"op":"add"}`, `[{"op":`, `"remove"`} {
+		_, err := Apply([]byte(`{}`), []byte(patch))
+
+		if !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("patch %s: got error %v; want %v", patch, err, ErrInvalidPatch)
+		}
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	doc := []byte(`{"title":"Moana","genres":["animation"]}`)
+	patch := []byte(`[{"op":"replace","path":"/title","value":"Cars"},{"op":"add","path":"/genres/-","value":"family"},{"op":"test","path":"/title","value":"Moana"}]`)
+
+	got, err := Apply(doc, patch)
+
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("got error %v; want %v", err, ErrTestFailed)
+	}
+
+	if got != nil {
+		t.Errorf("got document %s; want none", got)
+	}
+
+	assertJSON(t, doc, `{"title":"Moana","genres":["animation"]}`)
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace member",
+			doc:   `{"title":"Moana","year":2015}`,
+			patch: `{"year":2016}`,
+			want:  `{"title":"Moana","year":2016}`,
+		},
+		{
+			name:  "add member",
+			doc:   `{"title":"Moana"}`,
+			patch: `{"year":2016}`,
+			want:  `{"title":"Moana","year":2016}`,
+		},
+		{
+			name:  "null deletes member",
+			doc:   `{"title":"Moana","synopsis":"A girl sails"}`,
+			patch: `{"synopsis":null}`,
+			want:  `{"title":"Moana"}`,
+		},
+		{
+			name:  "null deletes missing member",
+			doc:   `{"title":"Moana"}`,
+			patch: `{"synopsis":null}`,
+			want:  `{"title":"Moana"}`,
+		},
+		{
+			name:  "nested null deletes nested member",
+			doc:   `{"meta":{"a":1,"b":2}}`,
+			patch: `{"meta":{"a":null}}`,
+			want:  `{"meta":{"b":2}}`,
+		},
+		{
+			name:  "objects merge recursively",
+			doc:   `{"meta":{"a":1}}`,
+			patch: `{"meta":{"b":2}}`,
+			want:  `{"meta":{"a":1,"b":2}}`,
+		},
+		{
+			name:  "arrays are replaced",
+			doc:   `{"genres":["animation","family"]}`,
+			patch: `{"genres":["drama"]}`,
+			want:  `{"genres":["drama"]}`,
+		},
+		{
+			name:  "object replaces scalar",
+			doc:   `{"meta":"none"}`,
+			patch: `{"meta":{"a":null,"b":1}}`,
+			want:  `{"meta":{"b":1}}`,
+		},
+		{
+			name:  "non object patch replaces document",
+			doc:   `{"title":"Moana"}`,
+			patch: `["a"]`,
+			want:  `["a"]`,
+		},
+		{
+			name:  "empty patch changes nothing",
+			doc:   `{"title":"Moana"}`,
+			patch: `{}`,
+			want:  `{"title":"Moana"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	_, err := MergePatch([]byte(`{}`), []byte(`{"title":`))
+
+	if !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidPatch)
+	}
+}
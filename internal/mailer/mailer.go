@@ -27,6 +27,17 @@ func New(host string, port int, username, password, sender string) Mailer {
 	}
 }
 
+// Ping dials the SMTP server and authenticates, without sending anything
+func (m Mailer) Ping() error {
+	conn, err := m.dialer.Dial()
+
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
 func (m Mailer) Send(recipient, templateFile string, data any) error {
 	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
 
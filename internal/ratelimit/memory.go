@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Memory keeps a token bucket per key in process memory. Every instance of
+// the API counts on its own, and the counts are lost on restart.
+type Memory struct {
+	mu      sync.Mutex
+	clients map[string]*client
+
+	// now returns the current time, it is only replaced by tests
+	now func() time.Time
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemory returns a Memory store. Keys unseen for three minutes are
+// forgotten.
+func NewMemory() *Memory {
+	m := &Memory{clients: make(map[string]*client), now: time.Now}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			// Cleaning up map, so need to lock
+			m.mu.Lock()
+
+			for key, client := range m.clients {
+				if m.now().Sub(client.lastSeen) > 3*time.Minute {
+					delete(m.clients, key)
+				}
+			}
+
+			m.mu.Unlock()
+		}
+	}()
+
+	return m
+}
+
+func (m *Memory) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	c, found := m.clients[key]
+
+	// A key whose limit changed starts over with the new one
+	if !found || c.limiter.Limit() != rate.Limit(limit.Rate) || c.limiter.Burst() != limit.Burst {
+		c = &client{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		m.clients[key] = c
+	}
+
+	c.lastSeen = now
+
+	allowed := c.limiter.AllowN(now, 1)
+	tokens := c.limiter.TokensAt(now)
+
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  max(0, int(math.Floor(tokens))),
+		ResetAfter: time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second)),
+	}
+
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+
+	return result, nil
+}
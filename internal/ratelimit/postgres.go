@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Postgres keeps the limits in a PostgreSQL table shared by every instance of
+// the API, using the generic cell rate algorithm (GCRA). A single timestamp
+// is stored per key: the theoretical arrival time (TAT) at which the bucket
+// would be full again. Each allowed request moves it forward by the interval
+// of the limit, and a request is denied when it would move it more than a
+// burst ahead of now. The check and the update are one atomic upsert.
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres returns a Postgres store. Expired keys are purged every minute,
+// errors are reported to logger.
+func NewPostgres(db *sql.DB, logger *slog.Logger) *Postgres {
+	p := &Postgres{db: db}
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			err := p.purge()
+
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *Postgres) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	interval := limit.interval().Seconds()
+	burst := float64(limit.Burst) * interval
+
+	// The returned value is the time left until the new TAT
+	stmt := `
+		INSERT INTO rate_limits AS rl (key, tat)
+		VALUES ($1, NOW() + make_interval(secs => $2))
+		ON CONFLICT (key) DO UPDATE
+		SET tat = GREATEST(rl.tat, NOW()) + make_interval(secs => $2)
+		WHERE GREATEST(rl.tat, NOW()) + make_interval(secs => $2) - make_interval(secs => $3) <= NOW()
+		RETURNING EXTRACT(EPOCH FROM tat - NOW())::float8
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var wait float64
+
+	err := p.db.QueryRowContext(ctx, stmt, key, interval, burst).Scan(&wait)
+
+	switch {
+	case err == nil:
+		return allowedResult(limit, wait), nil
+
+	case errors.Is(err, sql.ErrNoRows):
+		// Nothing was updated, the request is denied
+		stmt = `
+			SELECT EXTRACT(EPOCH FROM tat - NOW())::float8
+			FROM rate_limits
+			WHERE key = $1
+		`
+
+		err = p.db.QueryRowContext(ctx, stmt, key).Scan(&wait)
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		return deniedResult(limit, wait), nil
+
+	default:
+		return Result{}, err
+	}
+}
+
+// allowedResult is the result of an allowed request, given wait, the seconds
+// left until the TAT it moved forward. Every interval between now and the
+// tolerance of a burst is one more request allowed right away.
+func allowedResult(limit Limit, wait float64) Result {
+	interval := limit.interval().Seconds()
+	burst := float64(limit.Burst) * interval
+
+	return Result{
+		Allowed:    true,
+		Limit:      limit.Burst,
+		Remaining:  max(0, int(math.Floor((burst-wait)/interval))),
+		ResetAfter: seconds(wait),
+	}
+}
+
+// deniedResult is the result of a denied request, given wait, the seconds
+// left until the TAT. The next request is allowed once the TAT moved forward
+// by an interval is no more than a burst ahead.
+func deniedResult(limit Limit, wait float64) Result {
+	interval := limit.interval().Seconds()
+	burst := float64(limit.Burst) * interval
+
+	return Result{
+		Allowed:    false,
+		Limit:      limit.Burst,
+		Remaining:  0,
+		ResetAfter: seconds(wait),
+		RetryAfter: seconds(wait + interval - burst),
+	}
+}
+
+// purge deletes the keys whose bucket is full again, they hold no state
+func (p *Postgres) purge() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE tat < NOW()`)
+
+	return err
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(max(0, s) * float64(time.Second))
+}
@@ -0,0 +1,37 @@
+// Package ratelimit limits the rate of requests made under a key, such as a
+// client IP address, against stores shared by one or many API instances
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit allows Rate requests per second on average, in bursts of up to Burst
+// requests
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// interval is the time it takes to earn back a single request
+func (l Limit) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// Result is the outcome of a request against a limit. Remaining is the
+// number of requests allowed right away, ResetAfter the time until the full
+// burst is available again and RetryAfter, for a denied request, the time
+// until the next one is allowed.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of the limits by key
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
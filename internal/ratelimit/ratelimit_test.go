@@ -0,0 +1,242 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// fakeClock is a clock which only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestMemory(clock *fakeClock) *Memory {
+	m := NewMemory()
+	m.now = clock.Now
+
+	return m
+}
+
+// testStore is a store along with a way to move its clock forward. tolerance
+// is how far off the durations of its results may be.
+type testStore struct {
+	Store
+	advance   func(d time.Duration)
+	tolerance time.Duration
+}
+
+// testStores returns constructors of every store. The Postgres store runs
+// against the database of GREENLIGHT_TEST_DB_DSN and is skipped when it is
+// unset. Its clock is the real one, so time is moved forward by moving the
+// TAT of key back.
+func testStores() map[string]func(t *testing.T, key string) testStore {
+	return map[string]func(t *testing.T, key string) testStore{
+		"memory": func(t *testing.T, key string) testStore {
+			clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+			return testStore{Store: newTestMemory(clock), advance: clock.Advance, tolerance: time.Millisecond}
+		},
+		"postgres": func(t *testing.T, key string) testStore {
+			db := openTestDB(t)
+
+			deleteKey := func() {
+				_, err := db.Exec(`DELETE FROM rate_limits WHERE key = $1`, key)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			deleteKey()
+			t.Cleanup(deleteKey)
+
+			advance := func(d time.Duration) {
+				_, err := db.Exec(`UPDATE rate_limits SET tat = tat - make_interval(secs => $2) WHERE key = $1`, key, d.Seconds())
+
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Requests take real time, which is allowed for
+			return testStore{Store: &Postgres{db: db}, advance: advance, tolerance: 250 * time.Millisecond}
+		},
+	}
+}
+
+// openTestDB connects to the database of GREENLIGHT_TEST_DB_DSN, creating the
+// rate_limits table if needed
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+			key text NOT NULL PRIMARY KEY,
+			tat timestamp with time zone NOT NULL
+		)
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestStores(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 4}
+
+	// Each step waits, then makes a request
+	steps := []struct {
+		name string
+		wait time.Duration
+		want Result
+	}{
+		{name: "first of burst", want: Result{Allowed: true, Limit: 4, Remaining: 3, ResetAfter: 500 * time.Millisecond}},
+		{name: "second of burst", want: Result{Allowed: true, Limit: 4, Remaining: 2, ResetAfter: time.Second}},
+		{name: "third of burst", want: Result{Allowed: true, Limit: 4, Remaining: 1, ResetAfter: 1500 * time.Millisecond}},
+		{name: "last of burst", want: Result{Allowed: true, Limit: 4, Remaining: 0, ResetAfter: 2 * time.Second}},
+		{name: "burst used up", want: Result{Allowed: false, Limit: 4, Remaining: 0, ResetAfter: 2 * time.Second, RetryAfter: 500 * time.Millisecond}},
+		{name: "still waiting", wait: 200 * time.Millisecond, want: Result{Allowed: false, Limit: 4, Remaining: 0, ResetAfter: 1800 * time.Millisecond, RetryAfter: 300 * time.Millisecond}},
+		{name: "one request refilled", wait: 300 * time.Millisecond, want: Result{Allowed: true, Limit: 4, Remaining: 0, ResetAfter: 2 * time.Second}},
+		{name: "partly refilled", wait: time.Second, want: Result{Allowed: true, Limit: 4, Remaining: 1, ResetAfter: 1500 * time.Millisecond}},
+		{name: "fully refilled", wait: time.Minute, want: Result{Allowed: true, Limit: 4, Remaining: 3, ResetAfter: 500 * time.Millisecond}},
+	}
+
+	for name, newStore := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			key := "test:" + t.Name()
+			store := newStore(t, key)
+
+			for _, step := range steps {
+				store.advance(step.wait)
+
+				got, err := store.Allow(context.Background(), key, limit)
+
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", step.name, err)
+				}
+
+				assertResult(t, step.name, got, step.want, store.tolerance)
+			}
+		})
+	}
+}
+
+// The results Postgres builds from the seconds left until the TAT, which are
+// checked without a database
+func TestPostgresResults(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 4}
+
+	tests := []struct {
+		name string
+		got  Result
+		want Result
+	}{
+		{name: "allowed, empty bucket", got: allowedResult(limit, 0.5), want: Result{Allowed: true, Limit: 4, Remaining: 3, ResetAfter: 500 * time.Millisecond}},
+		{name: "allowed, time passed", got: allowedResult(limit, 0.49), want: Result{Allowed: true, Limit: 4, Remaining: 3, ResetAfter: 490 * time.Millisecond}},
+		{name: "allowed, last of burst", got: allowedResult(limit, 2), want: Result{Allowed: true, Limit: 4, Remaining: 0, ResetAfter: 2 * time.Second}},
+		{name: "denied", got: deniedResult(limit, 1.8), want: Result{Allowed: false, Limit: 4, Remaining: 0, ResetAfter: 1800 * time.Millisecond, RetryAfter: 300 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		assertResult(t, tt.name, tt.got, tt.want, time.Millisecond)
+	}
+}
+
+func TestMemoryKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := newTestMemory(clock)
+	limit := Limit{Rate: 1, Burst: 1}
+
+	got, _ := m.Allow(context.Background(), "ip:192.0.2.1", limit)
+	assertResult(t, "first key", got, Result{Allowed: true, Limit: 1, Remaining: 0, ResetAfter: time.Second}, time.Millisecond)
+
+	got, _ = m.Allow(context.Background(), "ip:192.0.2.1", limit)
+	assertResult(t, "first key again", got, Result{Allowed: false, Limit: 1, Remaining: 0, ResetAfter: time.Second, RetryAfter: time.Second}, time.Millisecond)
+
+	// Keys have buckets of their own
+	got, _ = m.Allow(context.Background(), "ip:192.0.2.2", limit)
+	assertResult(t, "second key", got, Result{Allowed: true, Limit: 1, Remaining: 0, ResetAfter: time.Second}, time.Millisecond)
+
+	// A key whose limit changed starts over with the new one
+	got, _ = m.Allow(context.Background(), "ip:192.0.2.1", Limit{Rate: 1, Burst: 3})
+	assertResult(t, "changed limit", got, Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second}, time.Millisecond)
+}
+
+func TestSlowLimit(t *testing.T) {
+	// One request a minute, as for movie imports
+	limit := Limit{Rate: 1.0 / 60, Burst: 2}
+
+	for name, newStore := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			key := "test:" + t.Name()
+			store := newStore(t, key)
+
+			store.Allow(context.Background(), key, limit)
+			store.Allow(context.Background(), key, limit)
+
+			store.advance(15 * time.Second)
+
+			got, err := store.Allow(context.Background(), key, limit)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertResult(t, "denied", got, Result{Allowed: false, Limit: 2, Remaining: 0, ResetAfter: 105 * time.Second, RetryAfter: 45 * time.Second}, store.tolerance)
+
+			store.advance(45 * time.Second)
+
+			got, err = store.Allow(context.Background(), key, limit)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertResult(t, "refilled", got, Result{Allowed: true, Limit: 2, Remaining: 0, ResetAfter: 120 * time.Second}, store.tolerance)
+		})
+	}
+}
+
+// assertResult compares results, allowing durations to be off by up to
+// tolerance
+func assertResult(t *testing.T, step string, got, want Result, tolerance time.Duration) {
+	t.Helper()
+
+	near := func(a, b time.Duration) bool {
+		return (a - b).Abs() <= tolerance
+	}
+
+	if got.Allowed != want.Allowed || got.Limit != want.Limit || got.Remaining != want.Remaining ||
+		!near(got.ResetAfter, want.ResetAfter) || !near(got.RetryAfter, want.RetryAfter) {
+		t.Errorf("%s: got %+v; want %+v", step, got, want)
+	}
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config holds the settings of an S3 compatible object store
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// PathStyle addresses the bucket as the first path segment rather than
+	// as a subdomain, which is what local stand-ins such as MinIO expect
+	PathStyle bool
+
+	// PublicURL is the base URL objects are served from, such as a CDN.
+	// Defaults to the bucket URL.
+	PublicURL string
+}
+
+// S3 stores blobs as objects of a bucket in an S3 compatible object store.
+// Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	cfg       S3Config
+	bucketURL *url.URL
+	client    *http.Client
+}
+
+// NewS3 returns an S3 storage for the bucket described by cfg
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("missing S3 bucket")
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	bucketURL := *endpoint
+
+	if cfg.PathStyle {
+		bucketURL.Path = strings.TrimSuffix(bucketURL.Path, "/") + "/" + cfg.Bucket
+	} else {
+		bucketURL.Host = cfg.Bucket + "." + bucketURL.Host
+	}
+
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = bucketURL.String()
+	}
+
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+
+	return &S3{
+		cfg:       cfg,
+		bucketURL: &bucketURL,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+
+	return s.do(ctx, http.MethodPut, key, data, headers)
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	// S3 answers 204 whether or not the object existed
+	return s.do(ctx, http.MethodDelete, key, nil, http.Header{})
+}
+
+func (s *S3) URL(key string) string {
+	return s.cfg.PublicURL + "/" + key
+}
+
+// do sends a signed request for the object stored under key
+func (s *S3) do(ctx context.Context, method, key string, body []byte, headers http.Header) error {
+	u := *s.bucketURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = int64(len(body))
+
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	s.sign(req, body, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("s3: %s %s: %s: %s", method, key, res.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 authorization to req
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	// Every header set so far is signed
+	names := make([]string, 0, len(req.Header))
+	canonicalHeaders := make(map[string]string, len(req.Header))
+
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		canonicalHeaders[lower] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	sort.Strings(names)
+
+	var headerBlock strings.Builder
+
+	for _, name := range names {
+		headerBlock.WriteString(name + ":" + canonicalHeaders[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headerBlock.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature,
+	))
+
+	// Go sends the host from req.Host, not from the header map
+	req.Header.Del("Host")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,41 @@
+// Package storage stores blobs, such as movie images, and tells where they
+// can be downloaded from.
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage stores blobs by key. Keys are slash separated paths such as
+// "movies/1/poster/small.jpg".
+type Storage interface {
+	// Put stores data under key, replacing any existing blob
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the public URL the blob stored under key is served from
+	URL(key string) string
+}
+
+// validKey reports whether key is a relative path without empty, "." or ".."
+// segments, so it can not escape the storage root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return false
+	}
+
+	for segment := range strings.SplitSeq(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
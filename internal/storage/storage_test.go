@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "movies/1/poster/small.jpg", want: true},
+		{key: "poster.jpg", want: true},
+		{key: "movies/..poster.jpg", want: true},
+		{key: "", want: false},
+		{key: "/movies/1/poster.jpg", want: false},
+		{key: "../secrets", want: false},
+		{key: "movies/../../secrets", want: false},
+		{key: "movies/..", want: false},
+		{key: "movies/./poster.jpg", want: false},
+		{key: "movies//poster.jpg", want: false},
+		{key: "movies/1/", want: false},
+		{key: `movies\..\secrets`, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := validKey(tt.key); got != tt.want {
+			t.Errorf("validKey(%q) = %t; want %t", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := NewLocal(filepath.Join(dir, "uploads"), "http://localhost:4000/media/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	key := "movies/1/poster/small.jpg"
+	path := filepath.Join(dir, "uploads", "movies", "1", "poster", "small.jpg")
+
+	err = l.Put(ctx, key, []byte("first"), "image/jpeg")
+
+	if err != nil {
+		t.Fatalf("Put: unexpected error: %v", err)
+	}
+
+	// A second Put replaces the blob
+	err = l.Put(ctx, key, []byte("second"), "image/jpeg")
+
+	if err != nil {
+		t.Fatalf("Put: unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "second" {
+		t.Errorf("got %q stored; want %q", data, "second")
+	}
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("got %d files next to the blob; want 1", len(entries))
+	}
+
+	if got := l.URL(key); got != "http://localhost:4000/media/movies/1/poster/small.jpg" {
+		t.Errorf("got URL %q", got)
+	}
+
+	f, err := l.FileSystem().Open("/" + key)
+
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+
+	served, _ := io.ReadAll(f)
+	f.Close()
+
+	if string(served) != "second" {
+		t.Errorf("got %q served; want %q", served, "second")
+	}
+
+	// Directories can not be listed
+	_, err = l.FileSystem().Open("/movies/1")
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open directory: got error %v; want %v", err, os.ErrNotExist)
+	}
+
+	err = l.Delete(ctx, key)
+
+	if err != nil {
+		t.Fatalf("Delete: unexpected error: %v", err)
+	}
+
+	_, err = os.Stat(path)
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v after Delete; want the file gone", err)
+	}
+
+	// Deleting a missing blob is not an error
+	err = l.Delete(ctx, key)
+
+	if err != nil {
+		t.Errorf("Delete missing: unexpected error: %v", err)
+	}
+}
+
+func TestLocalInvalidKey(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := NewLocal(filepath.Join(dir, "uploads"), "/media")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../escaped", "movies/../../escaped"} {
+		err := l.Put(context.Background(), key, []byte("x"), "text/plain")
+
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): got error %v; want %v", key, err, ErrInvalidKey)
+		}
+
+		err = l.Delete(context.Background(), key)
+
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q): got error %v; want %v", key, err, ErrInvalidKey)
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "escaped"))
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("a blob was written outside the storage root")
+	}
+}
@@ -0,0 +1,255 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rule checks value against the parameter of its tag, such as 500 in
+// max=500. It returns whether the value is valid and the error to record when
+// it is not. Pointers are dereferenced before the rule is called.
+type Rule func(value reflect.Value, param string) (bool, Error)
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{
+		"required": required,
+		"min":      minRule,
+		"max":      maxRule,
+		"len":      lenRule,
+		"unique":   unique,
+		"oneof":    oneOf,
+	}
+)
+
+func init() {
+	RegisterRule("email", func(value reflect.Value, _ string) (bool, Error) {
+		return Matches(value.String(), EmailRX), Format("email address")
+	})
+}
+
+// RegisterRule makes rule available to validate tags under name. Rules must
+// be registered before the first struct using them is validated, usually
+// from an init function.
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules[name] = rule
+}
+
+// tagRule is a rule of a validate tag along with its parameter. Rules
+// following dive apply to the elements of a slice.
+type tagRule struct {
+	name  string
+	param string
+	rule  Rule
+	dive  bool
+}
+
+// tagField holds the rules of a struct field and the JSON name it is keyed by
+type tagField struct {
+	index []int
+	name  string
+	rules []tagRule
+}
+
+// tagCache holds the parsed tags of every struct type validated so far
+var tagCache sync.Map
+
+// Struct checks the fields of the struct s points to against their validate
+// tags, such as `validate:"required,max=500"`. Errors are keyed by the JSON
+// pointer of the field. Rules other than required skip zero values, and the
+// rules following dive are checked against each element of a slice.
+func (v *Validator) Struct(s any) {
+	value := reflect.Indirect(reflect.ValueOf(s))
+
+	for _, field := range structFields(value.Type()) {
+		v.checkField(value.FieldByIndex(field.index), Pointer(field.name), field.rules)
+	}
+}
+
+func (v *Validator) checkField(value reflect.Value, key string, rules []tagRule) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			break
+		}
+
+		value = value.Elem()
+	}
+
+	for i, rule := range rules {
+		if rule.dive {
+			if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+				for j := 0; j < value.Len(); j++ {
+					v.checkField(value.Index(j), key+Pointer(j), rules[i+1:])
+				}
+			}
+
+			return
+		}
+
+		if rule.name != "required" && (value.Kind() == reflect.Pointer || value.IsZero()) {
+			continue
+		}
+
+		if ok, err := rule.rule(value, rule.param); !ok {
+			v.AddError(key, err)
+		}
+	}
+}
+
+// structFields returns the validated fields of t, parsing its tags on first use
+func structFields(t reflect.Type) []tagField {
+	if fields, ok := tagCache.Load(t); ok {
+		return fields.([]tagField)
+	}
+
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	fields := []tagField{}
+
+	for _, field := range reflect.VisibleFields(t) {
+		tag, ok := field.Tag.Lookup("validate")
+
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+
+		if jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ","); jsonName != "" && jsonName != "-" {
+			name = jsonName
+		}
+
+		f := tagField{index: field.Index, name: name}
+		dive := false
+
+		for part := range strings.SplitSeq(tag, ",") {
+			ruleName, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+			if ruleName == "dive" {
+				dive = true
+				f.rules = append(f.rules, tagRule{name: ruleName, dive: true})
+				continue
+			}
+
+			rule, ok := rules[ruleName]
+
+			if !ok {
+				panic(fmt.Sprintf("validator: unknown rule %q on %s.%s", ruleName, t, field.Name))
+			}
+
+			f.rules = append(f.rules, tagRule{name: ruleName, param: param, rule: rule})
+		}
+
+		// A trailing dive has no rule to apply
+		if dive && f.rules[len(f.rules)-1].dive {
+			panic(fmt.Sprintf("validator: dive without rules on %s.%s", t, field.Name))
+		}
+
+		fields = append(fields, f)
+	}
+
+	actual, _ := tagCache.LoadOrStore(t, fields)
+
+	return actual.([]tagField)
+}
+
+func required(value reflect.Value, _ string) (bool, Error) {
+	return value.IsValid() && !value.IsZero(), Required()
+}
+
+func minRule(value reflect.Value, param string) (bool, Error) {
+	switch value.Kind() {
+	case reflect.String:
+		n := intParam(param)
+		return value.Len() >= n, MinLength(n)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n := intParam(param)
+		return value.Len() >= n, MinItems(n)
+	default:
+		if n, err := strconv.ParseInt(param, 10, 64); err == nil {
+			return number(value) >= float64(n), Min(n)
+		}
+
+		n := floatParam(param)
+		return number(value) >= n, Min(n)
+	}
+}
+
+func maxRule(value reflect.Value, param string) (bool, Error) {
+	switch value.Kind() {
+	case reflect.String:
+		n := intParam(param)
+		return value.Len() <= n, MaxLength(n)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n := intParam(param)
+		return value.Len() <= n, MaxItems(n)
+	default:
+		if n, err := strconv.ParseInt(param, 10, 64); err == nil {
+			return number(value) <= float64(n), Max(n)
+		}
+
+		n := floatParam(param)
+		return number(value) <= n, Max(n)
+	}
+}
+
+func lenRule(value reflect.Value, param string) (bool, Error) {
+	n := intParam(param)
+	return value.Len() == n, Length(n)
+}
+
+func unique(value reflect.Value, _ string) (bool, Error) {
+	seen := make(map[any]bool, value.Len())
+
+	for i := 0; i < value.Len(); i++ {
+		seen[value.Index(i).Interface()] = true
+	}
+
+	return len(seen) == value.Len(), Duplicates()
+}
+
+// oneOf checks a value against the space separated values of its parameter
+func oneOf(value reflect.Value, param string) (bool, Error) {
+	values := strings.Fields(param)
+	return PermittedValue(fmt.Sprint(value.Interface()), values...), OneOf(values...)
+}
+
+func intParam(param string) int {
+	n, err := strconv.Atoi(param)
+
+	if err != nil {
+		panic(fmt.Sprintf("validator: %q is not an integer parameter", param))
+	}
+
+	return n
+}
+
+func floatParam(param string) float64 {
+	n, err := strconv.ParseFloat(param, 64)
+
+	if err != nil {
+		panic(fmt.Sprintf("validator: %q is not a number parameter", param))
+	}
+
+	return n
+}
+
+func number(value reflect.Value) float64 {
+	switch {
+	case value.CanInt():
+		return float64(value.Int())
+	case value.CanUint():
+		return float64(value.Uint())
+	case value.CanFloat():
+		return value.Float()
+	default:
+		panic(fmt.Sprintf("validator: min and max do not apply to %s values", value.Type()))
+	}
+}
@@ -0,0 +1,270 @@
+package validator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testMovie struct {
+	Title   string   `json:"title" validate:"required,max=10"`
+	Year    int32    `json:"year" validate:"required,min=1888,max=2100"`
+	Rating  float64  `json:"rating,omitempty" validate:"min=0.5,max=10"`
+	Genres  []string `json:"genres" validate:"required,min=1,max=3,unique,dive,required,max=8"`
+	Status  string   `json:"status" validate:"oneof=draft published"`
+	Code    string   `validate:"len=3"`
+	Notes   string   `json:"-" validate:"max=5"`
+	Ignored string   `json:"ignored"`
+	secret  string   `validate:"required"`
+}
+
+type testPointers struct {
+	Name  *string `json:"name" validate:"required,max=3"`
+	Limit *int    `json:"limit" validate:"min=1"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := testMovie{Title: "Casablanca", Year: 1942, Genres: []string{"drama"}}
+
+	tests := []struct {
+		name  string
+		movie func(m *testMovie)
+		want  map[string][]Error
+	}{
+		{
+			name:  "valid",
+			movie: func(m *testMovie) {},
+			want:  map[string][]Error{},
+		},
+		{
+			name: "required zero values",
+			movie: func(m *testMovie) {
+				m.Title = ""
+				m.Year = 0
+				m.Genres = nil
+			},
+			want: map[string][]Error{
+				"/title":  {Required()},
+				"/year":   {Required()},
+				"/genres": {Required()},
+			},
+		},
+		{
+			name: "limits",
+			movie: func(m *testMovie) {
+				m.Title = "Casablanca!"
+				m.Year = 1800
+				m.Rating = 0.1
+				m.Code = "ab"
+				m.Notes = "too long"
+			},
+			want: map[string][]Error{
+				"/title":  {MaxLength(10)},
+				"/year":   {Min(int64(1888))},
+				"/rating": {Min(0.5)},
+				"/Code":   {Length(3)},
+				"/Notes":  {MaxLength(5)},
+			},
+		},
+		{
+			name:  "oneof",
+			movie: func(m *testMovie) { m.Status = "deleted" },
+			want:  map[string][]Error{"/status": {OneOf("draft", "published")}},
+		},
+		{
+			name:  "empty slice is provided but too short",
+			movie: func(m *testMovie) { m.Genres = []string{} },
+			want:  map[string][]Error{"/genres": {MinItems(1)}},
+		},
+		{
+			name:  "slice rules",
+			movie: func(m *testMovie) { m.Genres = []string{"drama", "drama", "war", "romance"} },
+			want:  map[string][]Error{"/genres": {MaxItems(3), Duplicates()}},
+		},
+		{
+			name:  "dive keys elements by index",
+			movie: func(m *testMovie) { m.Genres = []string{"drama", "", "historical"} },
+			want: map[string][]Error{
+				"/genres/1": {Required()},
+				"/genres/2": {MaxLength(8)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := valid
+			tt.movie(&m)
+
+			v := New()
+			v.Struct(&m)
+
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("got errors %v; want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructPointers(t *testing.T) {
+	name := "Rick"
+	empty := ""
+	zero := 0
+	one := 1
+
+	tests := []struct {
+		name  string
+		input testPointers
+		want  map[string][]Error
+	}{
+		{
+			name:  "nil",
+			input: testPointers{},
+			want:  map[string][]Error{"/name": {Required()}},
+		},
+		{
+			name:  "pointer to zero value",
+			input: testPointers{Name: &empty, Limit: &zero},
+			want:  map[string][]Error{"/name": {Required()}},
+		},
+		{
+			name:  "dereferenced",
+			input: testPointers{Name: &name, Limit: &one},
+			want:  map[string][]Error{"/name": {MaxLength(3)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+
+			// Struct takes the struct itself as well as a pointer to it
+			v.Struct(tt.input)
+
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("got errors %v; want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructFieldsCache(t *testing.T) {
+	typ := reflect.TypeOf(testPointers{})
+
+	first := structFields(typ)
+
+	cached, ok := tagCache.Load(typ)
+
+	if !ok {
+		t.Fatal("fields were not cached")
+	}
+
+	second := structFields(typ)
+
+	if &first[0] != &second[0] || &first[0] != &cached.([]tagField)[0] {
+		t.Error("fields were parsed again")
+	}
+
+	// The unexported field and the one without a tag are left out
+	fields := structFields(reflect.TypeOf(testMovie{}))
+
+	var names []string
+
+	for _, field := range fields {
+		names = append(names, field.name)
+	}
+
+	if got := strings.Join(names, " "); got != "title year rating genres status Code Notes" {
+		t.Errorf("got fields %q", got)
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("test_even", func(value reflect.Value, param string) (bool, Error) {
+		return value.Int()%2 == 0, Invalid("even", "must be even "+param)
+	})
+
+	var input struct {
+		Count int `json:"count" validate:"test_even=please"`
+	}
+
+	input.Count = 3
+
+	v := New()
+	v.Struct(&input)
+
+	want := map[string][]Error{"/count": {Invalid("even", "must be even please")}}
+
+	if !reflect.DeepEqual(v.Errors, want) {
+		t.Errorf("got errors %v; want %v", v.Errors, want)
+	}
+
+	input.Count = 4
+
+	v = New()
+	v.Struct(&input)
+
+	if !v.Valid() {
+		t.Errorf("got errors %v; want none", v.Errors)
+	}
+}
+
+func TestStructPanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		input any
+		want  string
+	}{
+		{
+			name: "unknown rule",
+			input: &struct {
+				A string `validate:"nonsense"`
+			}{},
+			want: `unknown rule "nonsense"`,
+		},
+		{
+			name: "trailing dive",
+			input: &struct {
+				A []string `validate:"required,dive"`
+			}{},
+			want: "dive without rules",
+		},
+		{
+			name: "integer parameter",
+			input: &struct {
+				A string `validate:"max=many"`
+			}{A: "x"},
+			want: `"many" is not an integer parameter`,
+		},
+		{
+			name: "number parameter",
+			input: &struct {
+				A int `validate:"min=low"`
+			}{A: 1},
+			want: `"low" is not a number parameter`,
+		},
+		{
+			name: "not a number",
+			input: &struct {
+				A bool `validate:"min=1"`
+			}{A: true},
+			want: "min and max do not apply to bool values",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+
+				msg, _ := r.(string)
+
+				if !strings.Contains(msg, tt.want) {
+					t.Errorf("got panic %v; want it to contain %q", r, tt.want)
+				}
+			}()
+
+			New().Struct(tt.input)
+		})
+	}
+}
@@ -1,36 +1,154 @@
 package validator
 
 import (
+	"cmp"
+	"fmt"
 	"regexp"
 	"slices"
+	"strings"
+	"time"
 )
 
 var (
 	EmailRX = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
 )
 
+// Error is a single validation failure. Code is stable and Params holds the
+// values the message is built from, so clients can render their own message.
+type Error struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Params  map[string]any `json:"params,omitempty"`
+}
+
+// Validator collects every failure by key. The keys of body fields are JSON
+// pointers, such as /genres/2, and query parameters are keyed by name.
 type Validator struct {
-	Errors map[string]string
+	Errors map[string][]Error
 }
 
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{Errors: make(map[string][]Error)}
 }
 
 func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-func (v *Validator) AddError(key, message string) {
-	if _, exists := v.Errors[key]; !exists {
-		v.Errors[key] = message
+// AddError records err for key, unless an error with the same code was
+// already recorded for it
+func (v *Validator) AddError(key string, err Error) {
+	for _, existing := range v.Errors[key] {
+		if existing.Code == err.Code {
+			return
+		}
 	}
+
+	v.Errors[key] = append(v.Errors[key], err)
 }
 
-func (v *Validator) Check(ok bool, key, message string) {
+func (v *Validator) Check(ok bool, key string, err Error) {
 	if !ok {
-		v.AddError(key, message)
+		v.AddError(key, err)
+	}
+}
+
+// Pointer returns the JSON pointer made of tokens, such as /genres/2
+func Pointer(tokens ...any) string {
+	var pointer strings.Builder
+
+	for _, token := range tokens {
+		pointer.WriteString("/")
+		pointer.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(fmt.Sprint(token)))
 	}
+
+	return pointer.String()
+}
+
+func Required() Error {
+	return Error{Code: "required", Message: "must be provided"}
+}
+
+func MinLength(n int) Error {
+	return Error{Code: "min_length", Message: fmt.Sprintf("must be at least %d bytes long", n), Params: map[string]any{"limit": n}}
+}
+
+func MaxLength(n int) Error {
+	return Error{Code: "max_length", Message: fmt.Sprintf("must not be more than %d bytes long", n), Params: map[string]any{"limit": n}}
+}
+
+func Length(n int) Error {
+	return Error{Code: "length", Message: fmt.Sprintf("must be %d bytes long", n), Params: map[string]any{"length": n}}
+}
+
+func MinItems(n int) Error {
+	return Error{Code: "min_items", Message: fmt.Sprintf("must contain at least %d items", n), Params: map[string]any{"limit": n}}
+}
+
+func MaxItems(n int) Error {
+	return Error{Code: "max_items", Message: fmt.Sprintf("must not contain more than %d items", n), Params: map[string]any{"limit": n}}
+}
+
+// Duplicates is the error of a list which must hold unique values
+func Duplicates() Error {
+	return Error{Code: "unique", Message: "must not contain duplicate values"}
+}
+
+func Min[T cmp.Ordered](n T) Error {
+	return Error{Code: "min", Message: fmt.Sprintf("must be at least %v", n), Params: map[string]any{"limit": n}}
+}
+
+func Max[T cmp.Ordered](n T) Error {
+	return Error{Code: "max", Message: fmt.Sprintf("must not be more than %v", n), Params: map[string]any{"limit": n}}
+}
+
+func Range[T cmp.Ordered](min, max T) Error {
+	return Error{Code: "range", Message: fmt.Sprintf("must be between %v and %v", min, max), Params: map[string]any{"min": min, "max": max}}
+}
+
+// OneOf is the error of a value which is not one of values. With no values
+// at all, no value is permitted.
+func OneOf(values ...string) Error {
+	if len(values) == 0 {
+		return Error{Code: "one_of", Message: "is not permitted", Params: map[string]any{"values": []string{}}}
+	}
+
+	message := "must be " + values[0]
+
+	if len(values) > 1 {
+		message = fmt.Sprintf("must be one of %s or %s", strings.Join(values[:len(values)-1], ", "), values[len(values)-1])
+	}
+
+	return Error{Code: "one_of", Message: message, Params: map[string]any{"values": values}}
+}
+
+// Type is the error of a value which is not of the named type, such as an
+// integer
+func Type(name string) Error {
+	if name == "" {
+		return Error{Code: "type", Message: "has an invalid type"}
+	}
+
+	return Error{Code: "type", Message: "must be " + article(name) + " " + name + " value", Params: map[string]any{"type": name}}
+}
+
+// Format is the error of a value which is not written in the named format,
+// such as an email address
+func Format(name string) Error {
+	return Error{Code: "format", Message: "must be a valid " + name, Params: map[string]any{"format": name}}
+}
+
+// Invalid is an error without parameters
+func Invalid(code, message string) Error {
+	return Error{Code: code, Message: message}
+}
+
+func article(word string) string {
+	if word != "" && strings.ContainsRune("aeiou", rune(word[0])) {
+		return "an"
+	}
+
+	return "a"
 }
 
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
@@ -49,3 +167,21 @@ func Unique[T comparable](values []T) bool {
 
 	return len(values) == len(uniqueValues)
 }
+
+// Between reports whether value lies within min and max, both inclusive
+func Between[T cmp.Ordered](value, min, max T) bool {
+	return value >= min && value <= max
+}
+
+// OrderedRange reports whether low is not greater than high. A zero bound is
+// treated as unset, so a half-open range is always ordered.
+func OrderedRange[T cmp.Ordered](low, high T) bool {
+	var zero T
+	return low == zero || high == zero || low <= high
+}
+
+// OrderedTimes reports whether from is not after to. A zero time is treated
+// as unset.
+func OrderedTimes(from, to time.Time) bool {
+	return from.IsZero() || to.IsZero() || !from.After(to)
+}
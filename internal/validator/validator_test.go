@@ -0,0 +1,130 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPointer(t *testing.T) {
+	tests := []struct {
+		tokens []any
+		want   string
+	}{
+		{tokens: nil, want: ""},
+		{tokens: []any{"title"}, want: "/title"},
+		{tokens: []any{"genres", 2}, want: "/genres/2"},
+		{tokens: []any{"a/b"}, want: "/a~1b"},
+		{tokens: []any{"m~n"}, want: "/m~0n"},
+		{tokens: []any{"~1"}, want: "/~01"},
+		{tokens: []any{""}, want: "/"},
+	}
+
+	for _, tt := range tests {
+		if got := Pointer(tt.tokens...); got != tt.want {
+			t.Errorf("Pointer(%v) = %q; want %q", tt.tokens, got, tt.want)
+		}
+	}
+}
+
+func TestAddError(t *testing.T) {
+	v := New()
+
+	if !v.Valid() {
+		t.Fatal("new validator is not valid")
+	}
+
+	v.AddError("/title", Required())
+	v.AddError("/title", MaxLength(500))
+
+	// An error with a code already recorded for the key is dropped
+	v.AddError("/title", Required())
+	v.AddError("/title", MaxLength(10))
+
+	v.AddError("/genres/0", Required())
+
+	want := map[string][]Error{
+		"/title":    {Required(), MaxLength(500)},
+		"/genres/0": {Required()},
+	}
+
+	if !reflect.DeepEqual(v.Errors, want) {
+		t.Errorf("got errors %v; want %v", v.Errors, want)
+	}
+
+	if v.Valid() {
+		t.Error("got valid with errors recorded")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	v := New()
+
+	v.Check(true, "/title", Required())
+
+	if !v.Valid() {
+		t.Fatalf("got errors %v for a passing check", v.Errors)
+	}
+
+	v.Check(false, "/year", Min(1888))
+	v.Check(false, "/year", Max(2100))
+
+	want := map[string][]Error{"/year": {Min(1888), Max(2100)}}
+
+	if !reflect.DeepEqual(v.Errors, want) {
+		t.Errorf("got errors %v; want %v", v.Errors, want)
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   Error
+	}{
+		{
+			name:   "none",
+			values: nil,
+			want:   Error{Code: "one_of", Message: "is not permitted", Params: map[string]any{"values": []string{}}},
+		},
+		{
+			name:   "one",
+			values: []string{"id"},
+			want:   Error{Code: "one_of", Message: "must be id", Params: map[string]any{"values": []string{"id"}}},
+		},
+		{
+			name:   "two",
+			values: []string{"id", "title"},
+			want:   Error{Code: "one_of", Message: "must be one of id or title", Params: map[string]any{"values": []string{"id", "title"}}},
+		},
+		{
+			name:   "many",
+			values: []string{"id", "title", "year"},
+			want:   Error{Code: "one_of", Message: "must be one of id, title or year", Params: map[string]any{"values": []string{"id", "title", "year"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OneOf(tt.values...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestType(t *testing.T) {
+	tests := []struct {
+		name string
+		want Error
+	}{
+		{name: "", want: Error{Code: "type", Message: "has an invalid type"}},
+		{name: "integer", want: Error{Code: "type", Message: "must be an integer value", Params: map[string]any{"type": "integer"}}},
+		{name: "string", want: Error{Code: "type", Message: "must be a string value", Params: map[string]any{"type": "string"}}},
+	}
+
+	for _, tt := range tests {
+		if got := Type(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Type(%q) = %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+}
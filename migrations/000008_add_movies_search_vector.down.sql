@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS movies_search_vector_idx;
+
+DROP TRIGGER IF EXISTS movies_search_vector_trigger ON movies;
+
+DROP FUNCTION IF EXISTS movies_search_vector_update;
+
+ALTER TABLE movies
+DROP COLUMN IF EXISTS search_vector,
+DROP COLUMN IF EXISTS language,
+DROP COLUMN IF EXISTS synopsis,
+DROP COLUMN IF EXISTS alternate_titles,
+DROP COLUMN IF EXISTS original_title;
@@ -0,0 +1,35 @@
+ALTER TABLE movies
+ADD COLUMN IF NOT EXISTS original_title text NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS alternate_titles text [] NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS synopsis text NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS language regconfig NOT NULL DEFAULT 'simple',
+ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+-- The title is indexed with the movie language and, unstemmed, with the
+-- simple configuration, so a search in any language still matches it word
+-- for word
+CREATE OR REPLACE FUNCTION movies_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector(NEW.language, NEW.title), 'A') ||
+        setweight(to_tsvector('simple', NEW.title), 'A') ||
+        setweight(to_tsvector(
+            NEW.language,
+            NEW.original_title || ' ' || array_to_string(NEW.alternate_titles, ' ')
+        ), 'B') ||
+        setweight(to_tsvector(NEW.language, NEW.synopsis), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_search_vector_trigger
+BEFORE INSERT OR UPDATE OF title, original_title, alternate_titles, synopsis, language
+ON movies
+FOR EACH ROW EXECUTE FUNCTION movies_search_vector_update();
+
+-- Fill in the search vector of the existing movies
+UPDATE movies SET title = title;
+
+CREATE INDEX IF NOT EXISTS movies_search_vector_idx ON movies USING gin (
+    search_vector
+);
@@ -0,0 +1,3 @@
+ALTER TABLE movies
+DROP COLUMN IF EXISTS backdrop,
+DROP COLUMN IF EXISTS poster;
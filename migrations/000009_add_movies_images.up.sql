@@ -0,0 +1,3 @@
+ALTER TABLE movies
+ADD COLUMN IF NOT EXISTS poster jsonb,
+ADD COLUMN IF NOT EXISTS backdrop jsonb;
@@ -0,0 +1,6 @@
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key text NOT NULL PRIMARY KEY,
+    tat timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_tat_idx ON rate_limits (tat);